@@ -0,0 +1,178 @@
+package authy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditEntry is one record from the vault's audit log.
+type AuditEntry struct {
+	Timestamp time.Time
+	Action    string
+	Secret    string
+	Actor     string
+	Outcome   string
+	Detail    string
+}
+
+// AuditOption filters the entries returned by Audit.
+type AuditOption func(*auditConfig)
+
+type auditConfig struct {
+	secret string
+	since  time.Time
+	until  time.Time
+}
+
+// AuditSecret keeps only entries about the named secret.
+func AuditSecret(name string) AuditOption {
+	return func(c *auditConfig) {
+		c.secret = name
+	}
+}
+
+// AuditSince keeps only entries at or after t.
+func AuditSince(t time.Time) AuditOption {
+	return func(c *auditConfig) {
+		c.since = t
+	}
+}
+
+// AuditUntil keeps only entries before t.
+func AuditUntil(t time.Time) AuditOption {
+	return func(c *auditConfig) {
+		c.until = t
+	}
+}
+
+type auditShowResponse struct {
+	Entries []struct {
+		Timestamp string `json:"timestamp"`
+		Operation string `json:"operation"`
+		Secret    string `json:"secret"`
+		Actor     string `json:"actor"`
+		Outcome   string `json:"outcome"`
+		Detail    string `json:"detail"`
+	} `json:"entries"`
+	Total int `json:"total"`
+}
+
+// Audit returns the vault's audit log, oldest first, via
+// `authy audit show --count 0`. The CLI has no server-side filters, so the
+// options are applied in Go. It returns ErrNoAuditLog if the vault has no
+// audit log at all, and an empty slice if entries exist but none match.
+func (c *Client) Audit(ctx context.Context, opts ...AuditOption) ([]AuditEntry, error) {
+	cfg := &auditConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	out, err := c.runRaw(ctx, []string{"audit", "show", "--count", "0"}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp auditShowResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, invalidJSON(out, err)
+	}
+	if resp.Total == 0 {
+		return nil, ErrNoAuditLog
+	}
+
+	entries := make([]AuditEntry, 0, len(resp.Entries))
+	for _, e := range resp.Entries {
+		ts, err := time.Parse(time.RFC3339, e.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("authy: invalid audit timestamp: %w", err)
+		}
+		if cfg.secret != "" && e.Secret != cfg.secret {
+			continue
+		}
+		if !cfg.since.IsZero() && ts.Before(cfg.since) {
+			continue
+		}
+		if !cfg.until.IsZero() && !ts.Before(cfg.until) {
+			continue
+		}
+		entries = append(entries, AuditEntry{
+			Timestamp: ts,
+			Action:    e.Operation,
+			Secret:    e.Secret,
+			Actor:     e.Actor,
+			Outcome:   e.Outcome,
+			Detail:    e.Detail,
+		})
+	}
+	return entries, nil
+}
+
+// VersionInfo describes one version of a secret, as reconstructed by
+// History.
+type VersionInfo struct {
+	Version int
+	Time    time.Time
+	// Action is the audit operation that produced the version: "store",
+	// "update", "rotate", or "import".
+	Action string
+	Actor  string
+}
+
+// History returns the versions of the named secret since it was last
+// created, oldest first. The CLI keeps no version table, so the history is
+// reconstructed from the audit log: a store (or forced store) starts again
+// at version 1, a rotate or overwriting import bumps the version, and a
+// remove ends the history. Entries written before the audit log existed are
+// not reflected.
+//
+// History lists versions, not values: the CLI keeps only a secret's
+// current value, so GetVersion can fetch an earlier one only from CLI
+// releases that retain them. It returns ErrNoAuditLog if the vault has no
+// audit log.
+func (c *Client) History(ctx context.Context, name string) ([]VersionInfo, error) {
+	entries, err := c.Audit(ctx, AuditSecret(name))
+	if err != nil {
+		return nil, err
+	}
+	var versions []VersionInfo
+	for _, e := range entries {
+		if e.Outcome != "success" {
+			continue
+		}
+		next := 0
+		switch e.Action {
+		case "store", "update":
+			next = 1
+		case "rotate":
+			if v, ok := strings.CutPrefix(e.Detail, "version="); ok {
+				next, _ = strconv.Atoi(v)
+			}
+			if next == 0 && len(versions) > 0 {
+				next = versions[len(versions)-1].Version + 1
+			}
+		case "import":
+			if e.Detail == "overwrite" && len(versions) > 0 {
+				next = versions[len(versions)-1].Version + 1
+			} else {
+				next = 1
+			}
+		case "remove":
+			versions = nil
+		}
+		if next == 0 {
+			continue
+		}
+		if next == 1 {
+			versions = versions[:0]
+		}
+		versions = append(versions, VersionInfo{
+			Version: next,
+			Time:    e.Timestamp,
+			Action:  e.Action,
+			Actor:   e.Actor,
+		})
+	}
+	return versions, nil
+}
@@ -8,22 +8,72 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // Client is the main interface to the authy CLI.
 type Client struct {
-	binary   string
-	extraEnv []string
+	binary       string
+	extraEnv     []string
+	passphrase   string
+	passphraseFD bool
+	writeVerify  bool
+	retry        retryPolicy
+	logger       func(context.Context, Event)
+	tracer       Tracer
+	metrics      Metrics
+	redactNames  bool
+	version      string
+	passFunc     func(context.Context) (string, error)
+	cancelSignal os.Signal
+	cancelGrace  time.Duration
+	cache        *secretCache
+	vault        string
+	configFile   string
+	scope        string
+	procs        chan struct{}
+	timeout      time.Duration
+	writeOnce    sync.Once
+	writeSlot    chan struct{}
+	hooksMu      sync.Mutex
+	rotateHooks  map[string][]func(string)
 }
 
 type config struct {
-	binary     string
-	passphrase string
-	keyfile    string
+	binary       string
+	passphrase   string
+	passphraseFD bool
+	passFunc     func(context.Context) (string, error)
+	keyfile      string
+	token        string
+	env          []string
+	writeVerify  bool
+	retry        retryPolicy
+	logger       func(context.Context, Event)
+	tracer       Tracer
+	metrics      Metrics
+	redactNames  bool
+	minVersion   string
+	cancelSignal os.Signal
+	cancelGrace  time.Duration
+	cacheTTL     time.Duration
+	cacheMax     int
+	vault        string
+	configFile   string
+	scope        string
+	maxProcs     int
+	timeout      time.Duration
 }
 
 // Option configures a Client.
@@ -43,6 +93,29 @@ func WithPassphrase(pass string) Option {
 	}
 }
 
+// WithPassphraseFD delivers the passphrase set by WithPassphrase or
+// WithPassphraseFunc to authy over an inherited pipe (passed as
+// --passphrase-fd 3) instead of the AUTHY_PASSPHRASE env var, so it never
+// appears in the subprocess environment. The pipe is separate from stdin,
+// so it works alongside values passed to Store and Rotate. This requires an
+// authy CLI that supports --passphrase-fd and is not available on Windows.
+func WithPassphraseFD() Option {
+	return func(c *config) {
+		c.passphraseFD = true
+	}
+}
+
+// WithPassphraseFunc obtains the passphrase by calling fn before every CLI
+// invocation, so it can come from a KMS or rotate without rebuilding the
+// client. It takes precedence over WithPassphrase. The passphrase is set in
+// that invocation's AUTHY_PASSPHRASE only, or sent over a pipe when combined
+// with WithPassphraseFD. An error from fn aborts the call.
+func WithPassphraseFunc(fn func(ctx context.Context) (string, error)) Option {
+	return func(c *config) {
+		c.passFunc = fn
+	}
+}
+
 // WithKeyfile sets the path to the keyfile via the AUTHY_KEYFILE env var.
 func WithKeyfile(path string) Option {
 	return func(c *config) {
@@ -50,6 +123,93 @@ func WithKeyfile(path string) Option {
 	}
 }
 
+// WithToken sets a session token via the AUTHY_TOKEN env var, such as one
+// issued by IssueToken. The CLI also requires a keyfile (see WithKeyfile)
+// when authenticating with a token.
+func WithToken(token string) Option {
+	return func(c *config) {
+		c.token = token
+	}
+}
+
+// WithEnv sets an additional environment variable for the authy subprocess.
+// It may be given multiple times. Variables set this way are applied after
+// the process environment and after WithPassphrase, WithKeyfile, and
+// WithToken, so they override them; for duplicate keys the last value wins.
+func WithEnv(key, value string) Option {
+	return func(c *config) {
+		c.env = append(c.env, key+"="+value)
+	}
+}
+
+// WithWriteVerify makes Store and Rotate read the secret back after writing
+// and compare it to the value written, returning ErrWriteVerifyFailed on a
+// mismatch. This costs an extra subprocess per write.
+func WithWriteVerify() Option {
+	return func(c *config) {
+		c.writeVerify = true
+	}
+}
+
+// WithVault selects the named vault for every call by passing the global
+// --vault flag ahead of the subcommand. It needs an authy CLI that supports
+// multiple vaults; WithVaultScope overrides it for a single call. This is
+// unrelated to ImportVault, which names the source vault of an import.
+func WithVault(name string) Option {
+	return func(c *config) {
+		c.vault = name
+	}
+}
+
+// WithConfigFile points every call at an alternate authy config file via
+// the global --config flag. This requires an authy CLI that accepts it.
+func WithConfigFile(path string) Option {
+	return func(c *config) {
+		c.configFile = path
+	}
+}
+
+// WithDefaultScope applies scope to every call that takes WithScope, as if
+// WithScope(scope) were passed; a per-call WithScope overrides it.
+func WithDefaultScope(scope string) Option {
+	return func(c *config) {
+		c.scope = scope
+	}
+}
+
+// WithMaxConcurrentProcesses caps how many authy subprocesses the client
+// runs at once, across all goroutines sharing it, which tunes parallel read
+// throughput. Calls beyond the limit wait for a free slot, or fail if their
+// context ends first. n <= 0 means no limit, the default. Writes such as
+// Store and Rotate are always run one at a time per client. The process
+// behind a Session is not counted.
+func WithMaxConcurrentProcesses(n int) Option {
+	return func(c *config) {
+		c.maxProcs = n
+	}
+}
+
+// WithDefaultTimeout bounds every call made by the client to d, so a hung
+// authy binary cannot block indefinitely. WithTimeout overrides it for a
+// single call, and an earlier deadline on the caller's context still
+// applies. When d elapses the call fails with ErrTimeout.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithCancelSignal changes how subprocesses are stopped when a call's
+// context is done: sig is sent first, and if the process has not exited
+// after grace it is killed. The default is to kill immediately. This gives
+// commands started by Run a chance to flush output and clean up.
+func WithCancelSignal(sig os.Signal, grace time.Duration) Option {
+	return func(c *config) {
+		c.cancelSignal = sig
+		c.cancelGrace = grace
+	}
+}
+
 // New creates a new authy Client. It verifies the binary exists on PATH
 // (or at the specified path) and returns an error if not found.
 func New(opts ...Option) (*Client, error) {
@@ -62,31 +222,102 @@ func New(opts ...Option) (*Client, error) {
 	if binary == "" {
 		found, err := exec.LookPath("authy")
 		if err != nil {
-			return nil, fmt.Errorf("authy: binary not found on PATH: %w", err)
+			return nil, fmt.Errorf("%w on PATH: %v", ErrBinaryNotFound, err)
 		}
 		binary = found
 	}
 
+	if cfg.passphraseFD && runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("authy: WithPassphraseFD is not supported on windows")
+	}
+
 	var extraEnv []string
-	if cfg.passphrase != "" {
+	if cfg.passphrase != "" && !cfg.passphraseFD && cfg.passFunc == nil {
 		extraEnv = append(extraEnv, "AUTHY_PASSPHRASE="+cfg.passphrase)
 	}
 	if cfg.keyfile != "" {
 		extraEnv = append(extraEnv, "AUTHY_KEYFILE="+cfg.keyfile)
 	}
+	if cfg.token != "" {
+		extraEnv = append(extraEnv, "AUTHY_TOKEN="+cfg.token)
+	}
+	extraEnv = append(extraEnv, cfg.env...)
 
-	return &Client{
-		binary:   binary,
-		extraEnv: extraEnv,
-	}, nil
+	c := &Client{
+		binary:       binary,
+		extraEnv:     extraEnv,
+		passphrase:   cfg.passphrase,
+		passphraseFD: cfg.passphraseFD,
+		passFunc:     cfg.passFunc,
+		writeVerify:  cfg.writeVerify,
+		retry:        cfg.retry,
+		logger:       cfg.logger,
+		tracer:       cfg.tracer,
+		metrics:      cfg.metrics,
+		redactNames:  cfg.redactNames,
+		cancelSignal: cfg.cancelSignal,
+		cancelGrace:  cfg.cancelGrace,
+		vault:        cfg.vault,
+		configFile:   cfg.configFile,
+		scope:        cfg.scope,
+		timeout:      cfg.timeout,
+	}
+	if cfg.maxProcs > 0 {
+		c.procs = make(chan struct{}, cfg.maxProcs)
+	}
+	if cfg.cacheTTL > 0 {
+		c.cache = newSecretCache(cfg.cacheTTL, cfg.cacheMax)
+	}
+	if cfg.minVersion != "" {
+		if err := c.checkVersion(cfg.minVersion); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 // CallOption configures individual method calls.
 type CallOption func(*callConfig)
 
+// newCallConfig applies opts over the client's defaults.
+func (c *Client) newCallConfig(opts []CallOption) *callConfig {
+	cfg := &callConfig{scope: c.scope}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
 type callConfig struct {
-	force bool
-	scope string
+	force         bool
+	dryRun        bool
+	compareValues bool
+	scope         string
+	uppercase     bool
+	replaceDash   rune
+	envPrefix     string
+	namePrefix    string
+	nameGlob      string
+	tagFilter     map[string]string
+	modifiedSince time.Time
+	envMapping    func(string) string
+	stdout        io.Writer
+	stderr        io.Writer
+	stdin         io.Reader
+	childEnv      []string
+	quoting       DotenvQuoting
+	interactive   bool
+	diagnostics   io.Writer
+	vault         string
+	ttl           time.Duration
+	expiry        time.Time
+	tags          map[string]string
+	description   string
+	timeout       time.Duration
+	stdinWait     time.Duration
+	allowRetry    bool
+	concurrency   int
+	version       int
 }
 
 // Force enables the --force flag for operations like Store.
@@ -96,53 +327,649 @@ func Force() CallOption {
 	}
 }
 
-// WithScope sets the --scope flag for operations like List and Run.
+// DryRun makes batch deletions such as RemoveMany and RemoveByPrefix report
+// what they would remove without removing anything.
+func DryRun() CallOption {
+	return func(c *callConfig) {
+		c.dryRun = true
+	}
+}
+
+// CompareValues makes Diff compare secret values, not just versions. The
+// values are fetched and compared as SHA-256 digests inside this process;
+// neither they nor the digests appear in the report.
+func CompareValues() CallOption {
+	return func(c *callConfig) {
+		c.compareValues = true
+	}
+}
+
+// WithScope sets the --scope flag for Get, List, Run, and ExportDotenv.
+// Store, Remove, and Rotate accept it too: the CLI's write subcommands take
+// no scope, so the name is first checked against the scope's policy and
+// ErrPolicyDenied is returned if the scope cannot read it.
 func WithScope(scope string) CallOption {
 	return func(c *callConfig) {
 		c.scope = scope
 	}
 }
 
-// runCmd executes the authy CLI with the given arguments and optional stdin.
-// It returns the parsed JSON output from stdout, or an error parsed from stderr.
-func (c *Client) runCmd(ctx context.Context, args []string, stdin string) (map[string]any, error) {
-	cmd := exec.CommandContext(ctx, c.binary, append([]string{"--json"}, args...)...)
-	cmd.Env = append(os.Environ(), c.extraEnv...)
-	if stdin != "" {
-		cmd.Stdin = strings.NewReader(stdin)
+// WithPrefix limits List and ListDetailed to secrets whose names start with
+// prefix. The authy CLI has no server-side name filter, so the full listing
+// is fetched and filtered in Go. It composes with WithScope.
+func WithPrefix(prefix string) CallOption {
+	return func(c *callConfig) {
+		c.namePrefix = prefix
+	}
+}
+
+// WithGlob limits List and ListDetailed to secrets whose names match pattern,
+// using path.Match syntax (e.g. "svc-api/*"). Like WithPrefix, filtering
+// happens in Go after the listing is fetched.
+func WithGlob(pattern string) CallOption {
+	return func(c *callConfig) {
+		c.nameGlob = pattern
+	}
+}
+
+// WithTag limits List and ListDetailed to secrets tagged key=value (see
+// WithTags). Pass it more than once to require several tags. Like
+// WithPrefix, filtering happens in Go; secrets are never matched when the
+// CLI does not report tags.
+func WithTag(key, value string) CallOption {
+	return func(c *callConfig) {
+		if c.tagFilter == nil {
+			c.tagFilter = make(map[string]string)
+		}
+		c.tagFilter[key] = value
+	}
+}
+
+// ModifiedSince limits List and ListDetailed to secrets last modified (or,
+// if never modified, created) at or after t. Like WithPrefix, filtering
+// happens in Go; secrets whose timestamps the CLI omits are excluded.
+func ModifiedSince(t time.Time) CallOption {
+	return func(c *callConfig) {
+		c.modifiedSince = t
+	}
+}
+
+// WithVersion makes Get and its variants read a specific historical version
+// of a secret instead of the current one (--version). This requires an authy
+// CLI that retains version history.
+func WithVersion(v int) CallOption {
+	return func(c *callConfig) {
+		c.version = v
+	}
+}
+
+// WithUppercase upper-cases env var names injected by Run (--uppercase).
+func WithUppercase() CallOption {
+	return func(c *callConfig) {
+		c.uppercase = true
+	}
+}
+
+// WithReplaceDash replaces dashes in env var names injected by Run with r
+// (--replace-dash).
+func WithReplaceDash(r rune) CallOption {
+	return func(c *callConfig) {
+		c.replaceDash = r
+	}
+}
+
+// WithEnvPrefix prepends prefix to env var names injected by Run (--prefix).
+func WithEnvPrefix(prefix string) CallOption {
+	return func(c *callConfig) {
+		c.envPrefix = prefix
+	}
+}
+
+// WithEnvMapping sets a function that maps secret names to env var names
+// for Run. The authy CLI only supports the fixed transformations exposed by
+// WithUppercase, WithReplaceDash, and WithEnvPrefix, so when a mapping is set
+// Run resolves the secrets via `authy env` and starts the command itself.
+// This means secret values pass through the calling process; prefer the CLI
+// naming options when they are sufficient.
+func WithEnvMapping(fn func(secretName string) string) CallOption {
+	return func(c *callConfig) {
+		c.envMapping = fn
+	}
+}
+
+// WithStdout streams the stdout of a command started by Run to w instead of
+// collecting it in RunResult.Stdout. Pass the same writer to WithStdout and
+// WithStderr to combine both streams.
+func WithStdout(w io.Writer) CallOption {
+	return func(c *callConfig) {
+		c.stdout = w
+	}
+}
+
+// WithStderr streams the stderr of a command started by Run to w instead of
+// collecting it in RunResult.Stderr.
+func WithStderr(w io.Writer) CallOption {
+	return func(c *callConfig) {
+		c.stderr = w
+	}
+}
+
+// WithStdin feeds r to the stdin of a command started by Run. Without it
+// the command reads from the null device.
+func WithStdin(r io.Reader) CallOption {
+	return func(c *callConfig) {
+		c.stdin = r
+	}
+}
+
+// WithExtraEnv adds KEY=value entries to the environment of a command
+// started by Run, overriding variables inherited from this process.
+// Injected secrets still take precedence. Without WithEnvMapping the
+// entries are also visible to the authy CLI that launches the command.
+func WithExtraEnv(env []string) CallOption {
+	return func(c *callConfig) {
+		c.childEnv = append(c.childEnv, env...)
+	}
+}
+
+// WithInteractive connects a command started by Run directly to this
+// process's stdin, stdout, and stderr, so it can prompt on a terminal.
+// Output is not captured in RunResult, and it cannot be combined with
+// WithStdout, WithStderr, or WithStdin.
+func WithInteractive() CallOption {
+	return func(c *callConfig) {
+		c.interactive = true
+	}
+}
+
+// WithTimeout bounds a single call to d, overriding WithDefaultTimeout. If
+// ctx already has an earlier deadline, that deadline still applies. When d
+// elapses the call fails with an error matching both ErrTimeout and
+// context.DeadlineExceeded.
+func WithTimeout(d time.Duration) CallOption {
+	return func(c *callConfig) {
+		c.timeout = d
+	}
+}
+
+// WithTTL makes Store create a secret that expires after d, passed as
+// --ttl in whole seconds. This requires an authy CLI that supports expiring
+// secrets; once expired, reads fail with ErrSecretNotFound. See
+// SecretMetadata.ExpiresAt for the remaining lifetime.
+func WithTTL(d time.Duration) CallOption {
+	return func(c *callConfig) {
+		c.ttl = d
+	}
+}
+
+// WithExpiry makes Store or Rotate set the secret to expire at t. It is
+// passed to the CLI as --ttl, measured from the time of the call and
+// rounded up to whole seconds, so it has the same requirements as WithTTL
+// and cannot be combined with it.
+func WithExpiry(t time.Time) CallOption {
+	return func(c *callConfig) {
+		c.expiry = t
+	}
+}
+
+// WithTags attaches key=value tags to the secret on Store or Rotate, such
+// as an owning team, passed as one --tag flag per entry. Keys must be
+// non-empty and may not contain '='. This requires an authy CLI that
+// records tags; they are reported in SecretMetadata.Tags and
+// ListResult.Tags.
+func WithTags(tags map[string]string) CallOption {
+	return func(c *callConfig) {
+		c.tags = tags
+	}
+}
+
+// WithDescription attaches a free-form description to the secret on Store
+// or Rotate, passed as --description. Like WithTags it requires an authy
+// CLI that records it.
+func WithDescription(description string) CallOption {
+	return func(c *callConfig) {
+		c.description = description
+	}
+}
+
+// WithVaultScope selects the named vault for a single call, overriding
+// WithVault.
+func WithVaultScope(name string) CallOption {
+	return func(c *callConfig) {
+		c.vault = name
+	}
+}
+
+// WithStdinTimeout bounds how long a call may spend writing its input (such
+// as the value passed to Store or Rotate) to the CLI. If the CLI has not
+// consumed the input by then, it is killed and ErrStdinTimeout is returned.
+func WithStdinTimeout(d time.Duration) CallOption {
+	return func(c *callConfig) {
+		c.stdinWait = d
+	}
+}
+
+// withTimeout derives a context bounded by the call's WithTimeout, falling
+// back to the client's WithDefaultTimeout.
+func (c *Client) withTimeout(ctx context.Context, cfg *callConfig) (context.Context, context.CancelFunc) {
+	if (cfg == nil || cfg.timeout <= 0) && c.timeout > 0 {
+		return context.WithTimeoutCause(ctx, c.timeout, ErrTimeout)
+	}
+	return cfg.withTimeout(ctx)
+}
+
+// withTimeout derives a context bounded by the configured timeout, if any.
+// It is safe to call on a nil config.
+func (cfg *callConfig) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg == nil || cfg.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, cfg.timeout, ErrTimeout)
+}
+
+// ctxError wraps the error of a done ctx. If the deadline was set by
+// WithTimeout or WithDefaultTimeout rather than the caller, the error also
+// matches ErrTimeout.
+func ctxError(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(context.Cause(ctx), ErrTimeout) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return fmt.Errorf("authy: %w", err)
+}
+
+// command builds an exec.Cmd for the authy CLI with the client's
+// environment applied. Its argv is the global flags (see globalArgs), then
+// args, which start with the subcommand. The returned cleanup function must
+// be called once the command has finished; it also frees the process slot
+// taken under WithMaxConcurrentProcesses. The long-lived `serve` process
+// behind a Session takes no slot, so an open session cannot starve other
+// calls.
+func (c *Client) command(ctx context.Context, args []string, cfg *callConfig) (*exec.Cmd, func(), error) {
+	release := func() {}
+	if len(args) == 0 || args[0] != "serve" {
+		var err error
+		if release, err = c.acquireProcess(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	cleanup := release
+	env := c.extraEnv
+	pass := c.passphrase
+	if c.passFunc != nil {
+		var err error
+		if pass, err = c.passFunc(ctx); err != nil {
+			release()
+			return nil, nil, fmt.Errorf("authy: passphrase callback: %w", err)
+		}
+		if !c.passphraseFD {
+			env = append(env[:len(env):len(env)], "AUTHY_PASSPHRASE="+pass)
+		}
+	}
+	var extraFiles []*os.File
+	if c.passphraseFD {
+		r, err := passphrasePipe(pass)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		// ExtraFiles[0] becomes fd 3 in the child (see globalArgs).
+		extraFiles = append(extraFiles, r)
+		cleanup = func() {
+			r.Close()
+			release()
+		}
+	}
+	cmd := exec.CommandContext(ctx, c.binary, append(c.globalArgs(cfg), args...)...)
+	cmd.Env = mergeEnv(os.Environ(), env)
+	cmd.ExtraFiles = extraFiles
+	c.setCancel(cmd)
+	return cmd, cleanup, nil
+}
+
+// acquireProcess waits for a free process slot when the client was built
+// with WithMaxConcurrentProcesses, and returns the function that frees it.
+// It gives up if ctx ends first.
+func (c *Client) acquireProcess(ctx context.Context) (func(), error) {
+	if c.procs == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.procs <- struct{}{}:
+		return func() { <-c.procs }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("authy: waiting for a process slot: %w", ctx.Err())
+	}
+}
+
+// writeCommands lists the subcommands that save the vault file, with
+// nested subcommands written as "policy create".
+var writeCommands = map[string]bool{
+	"init":               true,
+	"store":              true,
+	"remove":             true,
+	"rotate":             true,
+	"import":             true,
+	"rekey":              true,
+	"policy create":      true,
+	"policy update":      true,
+	"policy remove":      true,
+	"session create":     true,
+	"session revoke":     true,
+	"session revoke-all": true,
+}
+
+// isWrite reports whether args invoke a subcommand that saves the vault.
+func isWrite(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if writeCommands[args[0]] {
+		return true
+	}
+	return len(args) > 1 && writeCommands[args[0]+" "+args[1]]
+}
+
+// acquireWrite serializes the client's vault writes. The CLI saves the vault
+// through a temporary file at a fixed path, so concurrent writers can fail
+// each other with spurious io_error; reads replace nothing and are not
+// serialized. It gives up if ctx ends first.
+func (c *Client) acquireWrite(ctx context.Context, args []string) (func(), error) {
+	if !isWrite(args) {
+		return func() {}, nil
+	}
+	return c.lockWrite(ctx)
+}
+
+// lockWrite takes the client's write slot, for writes made outside runOnce
+// such as those of a Session, and returns the function that frees it.
+func (c *Client) lockWrite(ctx context.Context) (func(), error) {
+	c.writeOnce.Do(func() {
+		c.writeSlot = make(chan struct{}, 1)
+	})
+	select {
+	case c.writeSlot <- struct{}{}:
+		return func() { <-c.writeSlot }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("authy: waiting for another write: %w", ctx.Err())
+	}
+}
+
+// globalArgs returns the flags that precede the subcommand on every
+// invocation, in a fixed order: --json, --passphrase-fd, --config, --vault.
+func (c *Client) globalArgs(cfg *callConfig) []string {
+	global := []string{"--json"}
+	if c.passphraseFD {
+		global = append(global, "--passphrase-fd", "3")
+	}
+	if c.configFile != "" {
+		global = append(global, "--config", c.configFile)
+	}
+	vault := c.vault
+	if cfg != nil && cfg.vault != "" {
+		vault = cfg.vault
+	}
+	if vault != "" {
+		global = append(global, "--vault", vault)
+	}
+	return global
+}
+
+// setCancel applies the client's cancellation signal, if any, to cmd.
+func (c *Client) setCancel(cmd *exec.Cmd) {
+	if c.cancelSignal == nil {
+		return
+	}
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(c.cancelSignal)
+	}
+	cmd.WaitDelay = c.cancelGrace
+}
+
+// passphrasePipe returns the read end of a pipe that yields pass and then
+// EOF. The write happens in the background; closing the read end unblocks
+// it if the child never reads.
+func passphrasePipe(pass string) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("authy: failed to create passphrase pipe: %w", err)
+	}
+	go func() {
+		w.WriteString(pass)
+		w.Close()
+	}()
+	return r, nil
+}
+
+// mergeEnv appends overrides to base, dropping earlier entries for any key
+// that is set again so the last value wins.
+func mergeEnv(base, overrides []string) []string {
+	all := append(append([]string{}, base...), overrides...)
+	last := make(map[string]int, len(all))
+	for i, kv := range all {
+		key, _, _ := strings.Cut(kv, "=")
+		last[key] = i
+	}
+	merged := make([]string, 0, len(last))
+	for i, kv := range all {
+		key, _, _ := strings.Cut(kv, "=")
+		if last[key] == i {
+			merged = append(merged, kv)
+		}
+	}
+	return merged
+}
+
+// runCmd executes the authy CLI with the given arguments and optional stdin,
+// which may be nil. Per-call settings are taken from cfg, which may also be
+// nil. The JSON output from stdout is decoded into v unless v is nil or the
+// output is empty. Failures are returned as errors parsed from stderr.
+func (c *Client) runCmd(ctx context.Context, args []string, stdin io.Reader, cfg *callConfig, v any) error {
+	out, err := c.runRaw(ctx, args, stdin, cfg)
+	if err != nil {
+		return err
+	}
+	// The raw output may hold a secret value; scrub it once parsed.
+	defer wipe(out)
+	if v == nil || len(out) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return invalidJSON(out, err)
+	}
+	return nil
+}
+
+// runRaw is like runCmd but returns stdout unparsed. Failures are retried
+// according to the client's retry policy.
+func (c *Client) runRaw(ctx context.Context, args []string, stdin io.Reader, cfg *callConfig) ([]byte, error) {
+	ctx, cancel := c.withTimeout(ctx, cfg)
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		out, err := c.runOnce(ctx, args, stdin, cfg)
+		if err == nil || attempt >= c.retry.attempts || !c.retry.shouldRetry(args, stdin, cfg, err) {
+			return out, err
+		}
+		if !c.retry.wait(ctx, attempt) {
+			return nil, err
+		}
+	}
+}
+
+// runOnce executes a single authy invocation and returns its stdout. The
+// CLI's stderr is also copied to cfg.diagnostics if set.
+func (c *Client) runOnce(ctx context.Context, args []string, stdin io.Reader, cfg *callConfig) ([]byte, error) {
+	unlock, err := c.acquireWrite(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	ctx, endSpan := c.startSpan(ctx, args, cfg)
+	cmd, cleanup, err := c.command(ctx, args, cfg)
+	if err != nil {
+		endSpan(-1, err)
+		return nil, err
 	}
+	defer cleanup()
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if cfg != nil && cfg.diagnostics != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, cfg.diagnostics)
+	}
+
+	var stdinTimeout time.Duration
+	if cfg != nil {
+		stdinTimeout = cfg.stdinWait
+	}
 
-	if err := cmd.Run(); err != nil {
-		exitCode := -1
-		if cmd.ProcessState != nil {
-			exitCode = cmd.ProcessState.ExitCode()
+	start := time.Now()
+	err, stdinErr := runWithStdin(cmd, stdin, stdinTimeout)
+	if stdinErr != nil {
+		wipe(stdout.Bytes())
+		endSpan(-1, stdinErr)
+		c.logEvent(ctx, args, start, -1, stdinErr)
+		return nil, stdinErr
+	}
+	if err != nil {
+		wipe(stdout.Bytes())
+		exitCode, err := commandError(ctx, cmd, err, stderr.Bytes())
+		err = c.withArgs(err, args)
+		endSpan(exitCode, err)
+		c.logEvent(ctx, args, start, exitCode, err)
+		return nil, err
+	}
+	endSpan(0, nil)
+	c.logEvent(ctx, args, start, 0, nil)
+	return stdout.Bytes(), nil
+}
+
+// runWithStdin runs cmd, copying stdin to it from a separate goroutine. If
+// the process exits without reading its input, the resulting broken pipe is
+// ignored so that the process's own error is reported. If timeout is set
+// and the write has not finished by then, the process is killed and
+// ErrStdinTimeout is returned as stdinErr. The copy goroutine ends once the
+// pipe is closed, unless it is blocked reading from stdin itself.
+func runWithStdin(cmd *exec.Cmd, stdin io.Reader, timeout time.Duration) (err, stdinErr error) {
+	if stdin == nil {
+		return cmd.Run(), nil
+	}
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return err, nil
+	}
+	if err := cmd.Start(); err != nil {
+		return err, nil
+	}
+	written := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(pipe, stdin)
+		if closeErr := pipe.Close(); err == nil {
+			err = closeErr
+		}
+		written <- err
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err := <-written:
+		if err != nil && !errors.Is(err, syscall.EPIPE) && !errors.Is(err, os.ErrClosed) {
+			stdinErr = fmt.Errorf("authy: failed to write stdin: %w", err)
 		}
-		return nil, parseError(stderr.Bytes(), exitCode)
+	case <-expired:
+		cmd.Process.Kill()
+		pipe.Close()
+		stdinErr = fmt.Errorf("%w after %s", ErrStdinTimeout, timeout)
+	}
+	if stdinErr != nil {
+		cmd.Process.Kill()
+	}
+	return cmd.Wait(), stdinErr
+}
+
+// commandError converts a failed run of cmd into the error to return,
+// along with the process exit code (-1 if it did not exit normally).
+func commandError(ctx context.Context, cmd *exec.Cmd, err error, stderr []byte) (int, error) {
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
 	}
+	if runErr := runFailure(ctx, err); runErr != nil {
+		return exitCode, runErr
+	}
+	if jsonFlagRejected(stderr) {
+		return exitCode, fmt.Errorf("%w: %s", ErrJSONUnsupported, firstLine(stderr))
+	}
+	ae := parseError(stderr, exitCode)
+	ae.Err = err
+	return exitCode, ae
+}
 
-	if stdout.Len() == 0 {
-		return nil, nil
+// withArgs records args on err if it is an *AuthyError from the CLI.
+func (c *Client) withArgs(err error, args []string) error {
+	ae, ok := err.(*AuthyError)
+	if !ok {
+		return err
+	}
+	ae.Args = append([]string(nil), args...)
+	if c.redactNames && len(args) > 0 {
+		for _, i := range secretNameArgs(args) {
+			ae.Args[i] = redactedText
+		}
 	}
+	return ae
+}
 
-	var result map[string]any
-	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
-		return nil, fmt.Errorf("authy: invalid JSON output: %w", err)
+// runFailure classifies an error from running the CLI that is not a plain
+// non-zero exit: a cancelled or expired ctx is returned wrapped (even if the
+// process was killed as a result), and a missing binary is reported as
+// ErrBinaryNotFound. It returns nil for an ordinary non-zero exit, whose
+// stderr should be parsed instead.
+func runFailure(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctxError(ctx)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrBinaryNotFound, err)
 	}
-	return result, nil
+	return fmt.Errorf("authy: failed to run CLI: %w", err)
 }
 
-// IsInitialized checks whether an authy vault exists at the default location.
-// This is a package-level check that does not require authentication.
+// IsInitialized checks whether an authy vault exists at the default location
+// (see DefaultVaultPath). This is a package-level check that does not
+// require authentication.
 func IsInitialized() bool {
-	home, err := os.UserHomeDir()
+	path, err := DefaultVaultPath()
 	if err != nil {
 		return false
 	}
-	vaultPath := home + "/.authy/vault.age"
-	_, err = os.Stat(vaultPath)
+	return IsInitializedAt(path)
+}
+
+// IsInitializedAt checks whether an authy vault file exists at path.
+func IsInitializedAt(path string) bool {
+	_, err := os.Stat(path)
 	return err == nil
 }
+
+// DefaultVaultPath returns the vault path the authy CLI uses:
+// .authy/vault.age under the user's home directory. The CLI has no separate
+// setting for the vault location, so it follows $HOME (%USERPROFILE% on
+// Windows), which is also how os.UserHomeDir resolves it.
+func DefaultVaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".authy", "vault.age"), nil
+}
@@ -1,18 +1,38 @@
 package authy
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 // buildMockBinary compiles a small Go program that acts as a mock authy binary.
 // It reads the MOCK_STDOUT, MOCK_STDERR, and MOCK_EXIT env vars to control output.
+// Each can be overridden per subcommand by suffixing the upper-cased subcommand
+// name (e.g. MOCK_STDOUT_GET). If MOCK_ARGS_FILE is set, each invocation
+// appends its arguments to that file as one line, and can be overridden by
+// its 1-based call number (e.g. MOCK_STDOUT_3). If MOCK_STDIN_FILE is set,
+// stdin is copied to that file, and if MOCK_PASSPHRASE_FILE is set, fd 3 is.
+// MOCK_SLEEP_MS delays the response; if MOCK_TERM_FILE is set, a SIGTERM
+// received meanwhile is recorded in that file before exiting. The serve
+// subcommand answers JSON-RPC lines on stdin; each tools/call returns the
+// text in MOCK_TOOL_<NAME>, repeated MOCK_TOOLREPEAT_<NAME> times if set,
+// and is flagged as an error if MOCK_TOOLERR_<NAME> is set.
 func buildMockBinary(t *testing.T) string {
 	t.Helper()
 	dir := t.TempDir()
@@ -26,15 +46,120 @@ func buildMockBinary(t *testing.T) string {
 	mockSrc := `package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// globalValueFlags are global flags that take a value before the subcommand.
+var globalValueFlags = map[string]bool{"--passphrase-fd": true, "--config": true, "--vault": true}
+
+func subcommand() string {
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		if globalValueFlags[args[i]] {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			return strings.ToUpper(args[i])
+		}
+	}
+	return ""
+}
+
+// call is the 1-based number of this invocation, or 0 if not recorded.
+var call int
+
+func mockEnv(key, sub string) string {
+	if v, ok := os.LookupEnv(key + "_" + strconv.Itoa(call)); ok && call > 0 {
+		return v
+	}
+	if v, ok := os.LookupEnv(key + "_" + sub); ok {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// serve answers MCP requests until stdin is closed.
+func serve() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     *int64
+			Method string
+			Params struct{ Name string }
+		}
+		if json.Unmarshal(scanner.Bytes(), &req) != nil || req.ID == nil {
+			continue
+		}
+		result := map[string]any{}
+		if req.Method == "tools/call" {
+			tool := strings.ToUpper(req.Params.Name)
+			text := os.Getenv("MOCK_TOOL_" + tool)
+			if n, _ := strconv.Atoi(os.Getenv("MOCK_TOOLREPEAT_" + tool)); n > 0 {
+				text = strings.Repeat(text, n)
+			}
+			result["content"] = []map[string]string{{"type": "text", "text": text}}
+			if os.Getenv("MOCK_TOOLERR_"+tool) != "" {
+				result["isError"] = true
+			}
+		}
+		line, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": *req.ID, "result": result})
+		fmt.Println(string(line))
+	}
+}
+
 func main() {
-	stdout := os.Getenv("MOCK_STDOUT")
-	stderr := os.Getenv("MOCK_STDERR")
-	exitStr := os.Getenv("MOCK_EXIT")
+	if path := os.Getenv("MOCK_ARGS_FILE"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintln(f, strings.Join(os.Args[1:], " "))
+			f.Close()
+		}
+		data, _ := os.ReadFile(path)
+		call = strings.Count(string(data), "\n")
+	}
+
+	if path := os.Getenv("MOCK_PASSPHRASE_FILE"); path != "" {
+		data, _ := io.ReadAll(os.NewFile(3, "passphrase"))
+		os.WriteFile(path, data, 0644)
+	}
+
+	if path := os.Getenv("MOCK_STDIN_FILE"); path != "" {
+		data, _ := io.ReadAll(os.Stdin)
+		os.WriteFile(path, data, 0644)
+	}
+
+	if path := os.Getenv("MOCK_TERM_FILE"); path != "" {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			os.WriteFile(path, []byte("terminated"), 0644)
+			os.Exit(143)
+		}()
+	}
+
+	if ms, _ := strconv.Atoi(os.Getenv("MOCK_SLEEP_MS")); ms > 0 {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+	}
+
+	sub := subcommand()
+	if sub == "SERVE" {
+		serve()
+		return
+	}
+	stdout := mockEnv("MOCK_STDOUT", sub)
+	stderr := mockEnv("MOCK_STDERR", sub)
+	exitStr := mockEnv("MOCK_EXIT", sub)
 
 	if stdout != "" {
 		fmt.Fprint(os.Stdout, stdout)
@@ -78,6 +203,33 @@ func newMockClient(t *testing.T, bin string, mockStdout, mockStderr string, mock
 	}
 }
 
+// recordArgs makes the mock binary log its arguments and returns a function
+// that reads back one line per invocation.
+func recordArgs(t *testing.T, client *Client) func() []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "args.log")
+	client.extraEnv = append(client.extraEnv, "MOCK_ARGS_FILE="+path)
+	return func() []string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+}
+
+// recordStdin makes the mock binary save its stdin and returns a function
+// that reads it back.
+func recordStdin(t *testing.T, client *Client) func() string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin.log")
+	client.extraEnv = append(client.extraEnv, "MOCK_STDIN_FILE="+path)
+	return func() string {
+		data, _ := os.ReadFile(path)
+		return string(data)
+	}
+}
+
 func TestGet_ReturnsValue(t *testing.T) {
 	bin := buildMockBinary(t)
 	client := newMockClient(t, bin,
@@ -109,6 +261,93 @@ func TestGet_SecretNotFound(t *testing.T) {
 	}
 }
 
+func TestGet_ResponseShapes(t *testing.T) {
+	bin := buildMockBinary(t)
+	ctx := context.Background()
+
+	client := newMockClient(t, bin,
+		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`, "", 0)
+	if _, err := client.Get(ctx, "db-url"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected stdout error object to map to ErrSecretNotFound, got %v", err)
+	}
+	if _, ok, err := client.GetOpt(ctx, "db-url"); ok || err != nil {
+		t.Errorf("expected GetOpt to report missing, got ok=%v err=%v", ok, err)
+	}
+
+	client = newMockClient(t, bin, `{"name":"db-url","value":null,"version":2}`, "", 0)
+	if _, err := client.Get(ctx, "db-url"); !errors.Is(err, ErrSecretEmpty) {
+		t.Errorf("expected ErrSecretEmpty, got %v", err)
+	}
+	if _, err := client.GetSecret(ctx, "db-url"); !errors.Is(err, ErrSecretEmpty) {
+		t.Errorf("expected ErrSecretEmpty from GetSecret, got %v", err)
+	}
+
+	client = newMockClient(t, bin, `{"name":"db-url","secret":"x"}`, "", 0)
+	_, err := client.Get(ctx, "db-url")
+	if err == nil || !strings.Contains(err.Error(), "name, secret") {
+		t.Errorf("expected error listing keys, got %v", err)
+	}
+	client = newMockClient(t, bin, `{"name":"db-url","value":42,"version":"2"}`, "", 0)
+	_, err = client.Get(ctx, "db-url")
+	if err == nil || !strings.Contains(err.Error(), "invalid JSON output") {
+		t.Errorf("expected schema drift to fail decoding, got %v", err)
+	}
+}
+
+func TestJSONUnsupported(t *testing.T) {
+	bin := buildMockBinary(t)
+	ctx := context.Background()
+
+	client := newMockClient(t, bin, "", "error: unexpected argument '--json' found\n\nUsage: authy <COMMAND>\n", 2)
+	if _, err := client.Get(ctx, "db-url"); !errors.Is(err, ErrJSONUnsupported) {
+		t.Errorf("expected ErrJSONUnsupported for a rejected flag, got %v", err)
+	}
+
+	client = newMockClient(t, bin, "hunter2\n", "", 0)
+	_, err := client.Get(ctx, "db-url")
+	if !errors.Is(err, ErrJSONUnsupported) {
+		t.Errorf("expected ErrJSONUnsupported for plain-text output, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error leaked the output: %v", err)
+	}
+}
+
+func TestGetVersion_PassesFlag(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"name":"db-url","value":"old-value","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}`,
+		"", 0)
+	calls := recordArgs(t, client)
+
+	value, err := client.GetVersion(context.Background(), "db-url", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != "old-value" {
+		t.Errorf("expected 'old-value', got %q", value)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json get db-url --version 2" {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestGetVersion_VersionNotFound(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"version_not_found","message":"Version 9 not found for secret: db-url","exit_code":3}}`,
+		3)
+
+	_, err := client.GetVersion(context.Background(), "db-url", 9)
+	if !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("expected ErrVersionNotFound, got %v", err)
+	}
+	if errors.Is(err, ErrSecretNotFound) {
+		t.Error("expected version-not-found to be distinct from ErrSecretNotFound")
+	}
+}
+
 func TestGetOpt_Missing(t *testing.T) {
 	bin := buildMockBinary(t)
 	client := newMockClient(t, bin,
@@ -128,211 +367,3352 @@ func TestGetOpt_Missing(t *testing.T) {
 	}
 }
 
-func TestStore_PassesStdin(t *testing.T) {
+func TestGetOr(t *testing.T) {
 	bin := buildMockBinary(t)
-	// Store doesn't return JSON stdout on success
-	client := newMockClient(t, bin, "", "", 0)
+	ctx := context.Background()
 
-	err := client.Store(context.Background(), "api-key", "secret-value-123")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	client := newMockClient(t, bin, "",
+		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`, 3)
+	if value, err := client.GetOr(ctx, "db-url", "fallback"); err != nil || value != "fallback" {
+		t.Errorf("GetOr on missing = %q, %v", value, err)
+	}
+
+	client = newMockClient(t, bin, "",
+		`{"error":{"code":"access_denied","message":"Access denied","exit_code":4}}`, 4)
+	if _, err := client.GetOr(ctx, "db-url", "fallback"); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("expected ErrPolicyDenied, got %v", err)
+	}
+
+	client = newMockClient(t, bin, `{"name":"db-url","value":"real","version":1}`, "", 0)
+	if value, err := client.GetOr(ctx, "db-url", "fallback"); err != nil || value != "real" {
+		t.Errorf("GetOr on existing = %q, %v", value, err)
 	}
 }
 
-func TestStore_AlreadyExists(t *testing.T) {
+func TestGetMetadata_ParsesTimestamps(t *testing.T) {
 	bin := buildMockBinary(t)
 	client := newMockClient(t, bin,
-		"",
-		`{"error":{"code":"already_exists","message":"Secret already exists: api-key","exit_code":5}}`,
-		5)
+		`{"secrets":[{"name":"db-url","version":3,"created":"2025-01-01T00:00:00+00:00","modified":"2025-02-01T12:30:00.123456+00:00"}]}`,
+		"", 0)
 
-	err := client.Store(context.Background(), "api-key", "value")
-	if err == nil {
-		t.Fatal("expected error, got nil")
+	meta, err := client.GetMetadata(context.Background(), "db-url")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if !errors.Is(err, ErrSecretAlreadyExists) {
-		t.Errorf("expected ErrSecretAlreadyExists, got %v", err)
+	if meta.Name != "db-url" || meta.Version != 3 {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if !meta.Created.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected created time: %v", meta.Created)
+	}
+	if !meta.Modified.Equal(time.Date(2025, 2, 1, 12, 30, 0, 123456000, time.UTC)) {
+		t.Errorf("unexpected modified time: %v", meta.Modified)
 	}
 }
 
-func TestStore_Force(t *testing.T) {
+func TestGetMetadata_ExpiresAt(t *testing.T) {
 	bin := buildMockBinary(t)
-	client := newMockClient(t, bin, "", "", 0)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"token","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z","expires_at":"2025-01-01T01:00:00Z"}]}`,
+		"", 0)
 
-	err := client.Store(context.Background(), "api-key", "new-value", Force())
+	meta, err := client.GetMetadata(context.Background(), "token")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if meta.ExpiresAt == nil || meta.ExpiresAt.Sub(meta.Created) != time.Hour {
+		t.Errorf("unexpected ExpiresAt: %v", meta.ExpiresAt)
+	}
 }
 
-func TestList_ReturnsNames(t *testing.T) {
+func TestGetMetadata_UsesListingWithOptions(t *testing.T) {
 	bin := buildMockBinary(t)
 	client := newMockClient(t, bin,
-		`{"secrets":[{"name":"db-url","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"},{"name":"api-key","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-01-02T00:00:00Z"}]}`,
+		`{"secrets":[{"name":"api-key","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}]}`,
 		"", 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
 
-	names, err := client.List(context.Background())
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	if _, err := client.GetMetadata(ctx, "db-url", WithScope("deploy"), WithVaultScope("staging")); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound for an unlisted secret, got %v", err)
 	}
-	if len(names) != 2 {
-		t.Fatalf("expected 2 names, got %d", len(names))
-	}
-	if names[0] != "db-url" {
-		t.Errorf("expected 'db-url', got %q", names[0])
+	if got := args(); len(got) != 1 || got[0] != "--json --vault staging list --scope deploy" {
+		t.Errorf("unexpected args: %q", got)
 	}
-	if names[1] != "api-key" {
-		t.Errorf("expected 'api-key', got %q", names[1])
+}
+
+func TestGetMetadata_SecretNotFound(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`,
+		3)
+
+	_, err := client.GetMetadata(context.Background(), "db-url")
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
 	}
 }
 
-func TestList_WithScope(t *testing.T) {
+func TestGetSecret_DestroyZeroes(t *testing.T) {
 	bin := buildMockBinary(t)
 	client := newMockClient(t, bin,
-		`{"secrets":[{"name":"db-url","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}]}`,
+		`{"name":"db-url","value":"p\u00e4ss\"word\n\ud83d\ude00","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}`,
 		"", 0)
 
-	names, err := client.List(context.Background(), WithScope("deploy"))
+	secret, err := client.GetSecret(context.Background(), "db-url")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(names) != 1 {
-		t.Fatalf("expected 1 name, got %d", len(names))
+	value := secret.Bytes()
+	if string(value) != "p\u00e4ss\"word\n\U0001F600" {
+		t.Errorf("unexpected value: %q", value)
 	}
-	if names[0] != "db-url" {
-		t.Errorf("expected 'db-url', got %q", names[0])
+	secret.Destroy()
+	for _, b := range value {
+		if b != 0 {
+			t.Fatalf("expected zeroed buffer, got %q", value)
+		}
+	}
+	if secret.Bytes() != nil {
+		t.Error("expected nil value after Destroy")
 	}
 }
 
-func TestCredentialsInEnv(t *testing.T) {
-	client, err := New(
-		WithBinary("/bin/true"),
-		WithPassphrase("my-passphrase"),
-		WithKeyfile("/path/to/keyfile"),
-	)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+func TestSecret_Redacts(t *testing.T) {
+	secret := &Secret{value: []byte("hunter2")}
+	if got := fmt.Sprintf("%v %s %#v", secret, secret, secret); strings.Contains(got, "hunter2") {
+		t.Errorf("formatting leaks value: %s", got)
+	}
+	data, err := json.Marshal(struct{ Password *Secret }{secret})
+	if err != nil || string(data) != `{"Password":"[REDACTED]"}` {
+		t.Errorf("unexpected JSON: %s (%v)", data, err)
+	}
+	if secret.Reveal() != "hunter2" {
+		t.Errorf("expected Reveal to return the value, got %q", secret.Reveal())
 	}
+}
 
-	foundPassphrase := false
-	foundKeyfile := false
-	for _, env := range client.extraEnv {
-		if env == "AUTHY_PASSPHRASE=my-passphrase" {
-			foundPassphrase = true
-		}
-		if env == "AUTHY_KEYFILE=/path/to/keyfile" {
-			foundKeyfile = true
-		}
+func TestExists(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"api-key","version":1},{"name":"db-url","version":3}]}`,
+		"", 0)
+	args := recordArgs(t, client)
+	exists, err := client.Exists(context.Background(), "db-url")
+	if err != nil || !exists {
+		t.Errorf("expected exists=true, got %v (%v)", exists, err)
+	}
+	exists, err = client.Exists(context.Background(), "db")
+	if err != nil || exists {
+		t.Errorf("expected exists=false, got %v (%v)", exists, err)
+	}
+	if got := args(); len(got) != 2 || got[0] != "--json list" {
+		t.Errorf("expected metadata-only list calls, got %q", got)
 	}
 
-	if !foundPassphrase {
-		t.Error("expected AUTHY_PASSPHRASE in extraEnv")
+	client = newMockClient(t, bin,
+		"",
+		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`,
+		3)
+	exists, err = client.Exists(context.Background(), "db-url", WithVersion(2))
+	if err != nil || exists {
+		t.Errorf("expected exists=false, got %v (%v)", exists, err)
 	}
-	if !foundKeyfile {
-		t.Error("expected AUTHY_KEYFILE in extraEnv")
+
+	client = newMockClient(t, bin,
+		"",
+		`{"error":{"code":"auth_failed","message":"Authentication failed","exit_code":2}}`,
+		2)
+	if _, err := client.Exists(context.Background(), "db-url"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
 	}
 }
 
-func TestContextCancellation(t *testing.T) {
+func TestBatchGet_ReturnsValues(t *testing.T) {
 	bin := buildMockBinary(t)
-	// Use a mock that sleeps — but since our mock doesn't sleep,
-	// we test with an already-cancelled context.
-	client := newMockClient(t, bin, "", "", 0)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	cancel() // cancel immediately
+	client := newMockClient(t, bin,
+		`{"name":"db-url","value":"shared-value","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}`,
+		"", 0)
 
-	_, err := client.Get(ctx, "any-key")
-	if err == nil {
-		t.Fatal("expected error from cancelled context, got nil")
+	values, err := client.BatchGet(context.Background(), []string{"a", "b", "c"}, WithConcurrency(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(values) != 3 || values["b"] != "shared-value" {
+		t.Errorf("unexpected values: %v", values)
 	}
 }
 
-func TestRemove_Success(t *testing.T) {
+func TestGetMany_BoundedConcurrency(t *testing.T) {
 	bin := buildMockBinary(t)
-	client := newMockClient(t, bin, "", "", 0)
+	client := newMockClient(t, bin, `{"name":"x","value":"v","version":1}`, "", 0)
+	args := recordArgs(t, client)
 
-	removed, err := client.Remove(context.Background(), "db-url")
+	names := []string{"a", "b", "c", "d", "e"}
+	values, err := client.GetMany(context.Background(), names, WithConcurrency(2))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !removed {
-		t.Error("expected removed=true")
+	if len(values) != len(names) {
+		t.Errorf("expected %d values, got %v", len(names), values)
+	}
+	if got := args(); len(got) != len(names) {
+		t.Errorf("expected one get per name, got %q", got)
 	}
 }
 
-func TestRemove_NotFound(t *testing.T) {
+func TestBatchGet_PartialFailure(t *testing.T) {
 	bin := buildMockBinary(t)
 	client := newMockClient(t, bin,
 		"",
-		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`,
+		`{"error":{"code":"not_found","message":"Secret not found","exit_code":3}}`,
 		3)
 
-	_, err := client.Remove(context.Background(), "db-url")
-	if err == nil {
-		t.Fatal("expected error, got nil")
-	}
+	values, err := client.BatchGet(context.Background(), []string{"a", "b"})
 	if !errors.Is(err, ErrSecretNotFound) {
-		t.Errorf("expected ErrSecretNotFound, got %v", err)
+		t.Errorf("expected joined ErrSecretNotFound, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"a"`) || !strings.Contains(err.Error(), `"b"`) {
+		t.Errorf("expected error to name failed secrets, got %v", err)
+	}
+	if len(values) != 0 {
+		t.Errorf("expected no values, got %v", values)
 	}
 }
 
-func TestAuthFailed(t *testing.T) {
+func TestUnmarshal_PopulatesTaggedFields(t *testing.T) {
 	bin := buildMockBinary(t)
-	client := newMockClient(t, bin,
-		"",
-		`{"error":{"code":"auth_failed","message":"Authentication failed: wrong passphrase","exit_code":2}}`,
-		2)
+	client := newMockClient(t, bin, `{"name":"x","value":"2025-01-01T00:00:00Z","version":1}`, "", 0)
 
-	_, err := client.Get(context.Background(), "db-url")
-	if err == nil {
-		t.Fatal("expected error, got nil")
+	var cfg struct {
+		URL      string    `authy:"db-url"`
+		Key      []byte    `authy:"api-key"`
+		Deadline time.Time `authy:"deadline"`
+		Ignored  string
 	}
-	if !errors.Is(err, ErrAuthFailed) {
-		t.Errorf("expected ErrAuthFailed, got %v", err)
+	if err := client.Unmarshal(context.Background(), &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.URL != "2025-01-01T00:00:00Z" || string(cfg.Key) != cfg.URL || cfg.Deadline.Year() != 2025 {
+		t.Errorf("unexpected result: %+v", cfg)
+	}
+	if cfg.Ignored != "" {
+		t.Errorf("untagged field was set: %q", cfg.Ignored)
 	}
 }
 
-func TestPolicyDenied(t *testing.T) {
+func TestUnmarshal_OptionalAndErrors(t *testing.T) {
 	bin := buildMockBinary(t)
-	client := newMockClient(t, bin,
-		"",
-		`{"error":{"code":"access_denied","message":"Access denied","exit_code":4}}`,
-		4)
+	client := newMockClient(t, bin, "",
+		`{"error":{"code":"not_found","message":"Secret not found","exit_code":3}}`, 3)
+	ctx := context.Background()
 
-	_, err := client.Get(context.Background(), "db-url")
-	if err == nil {
-		t.Fatal("expected error, got nil")
+	optional := struct {
+		Token string `authy:"token,optional"`
+	}{Token: "default"}
+	if err := client.Unmarshal(ctx, &optional); err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if !errors.Is(err, ErrPolicyDenied) {
-		t.Errorf("expected ErrPolicyDenied, got %v", err)
+	if optional.Token != "default" {
+		t.Errorf("optional field overwritten: %q", optional.Token)
+	}
+
+	var required struct {
+		Token string `authy:"token"`
+	}
+	err := client.Unmarshal(ctx, &required)
+	if !errors.Is(err, ErrSecretNotFound) || !strings.Contains(err.Error(), "Token") {
+		t.Errorf("expected not-found error naming the field, got %v", err)
+	}
+
+	var unsupported struct {
+		Port int `authy:"port"`
+	}
+	if err := client.Unmarshal(ctx, &unsupported); err == nil {
+		t.Error("expected error for unsupported field type")
+	}
+	if err := client.Unmarshal(ctx, required); err == nil {
+		t.Error("expected error for non-pointer argument")
 	}
 }
 
-func TestVaultNotFound(t *testing.T) {
+func TestStoreAll_SortedAndJoinsErrors(t *testing.T) {
 	bin := buildMockBinary(t)
-	client := newMockClient(t, bin,
-		"",
-		`{"error":{"code":"vault_not_initialized","message":"Vault not initialized","exit_code":7}}`,
-		7)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_2={"error":{"code":"already_exists","message":"Secret already exists: b","exit_code":5}}`,
+		"MOCK_EXIT_2=5",
+	)
 
-	_, err := client.Get(context.Background(), "db-url")
-	if err == nil {
-		t.Fatal("expected error, got nil")
+	err := client.StoreAll(context.Background(), map[string]string{"c": "3", "a": "1", "b": "2"}, Force())
+	if !errors.Is(err, ErrSecretAlreadyExists) || !strings.Contains(err.Error(), `"b"`) {
+		t.Errorf("expected joined already_exists for b, got %v", err)
 	}
-	if !errors.Is(err, ErrVaultNotFound) {
-		t.Errorf("expected ErrVaultNotFound, got %v", err)
+	want := []string{"--json store a --force", "--json store b --force", "--json store c --force"}
+	if got := args(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected calls: %q", got)
 	}
 }
 
-func TestNew_DefaultLooksOnPath(t *testing.T) {
-	// This test just ensures that New() without WithBinary tries LookPath.
-	// It may fail in environments without authy on PATH, which is expected.
-	_, err := New()
-	if err != nil {
+func TestRemoveByPrefix(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"pr-12-db","version":1},{"name":"prod-db","version":3},{"name":"pr-12-api","version":1}]}`,
+		"", 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	n, err := client.RemoveByPrefix(ctx, "pr-12-", DryRun())
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 would-be removals, got %d, %v", n, err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json list" {
+		t.Errorf("expected only a list in dry run, got %q", got)
+	}
+
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_3={"error":{"code":"not_found","message":"Secret not found: pr-12-api","exit_code":3}}`,
+		"MOCK_EXIT_3=3",
+	)
+	n, err = client.RemoveByPrefix(ctx, "pr-12-")
+	if err != nil || n != 1 {
+		t.Errorf("expected 1 removal with the vanished secret skipped, got %d, %v", n, err)
+	}
+	want := []string{"--json list", "--json list", "--json remove pr-12-db", "--json remove pr-12-api"}
+	if got := args(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected calls: %q", got)
+	}
+
+	if _, err := client.RemoveByPrefix(ctx, ""); err == nil {
+		t.Error("expected an empty prefix to be rejected")
+	}
+}
+
+func TestRemoveMany_DryRunAndErrors(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[{"name":"a","version":1},{"name":"b","version":1}]}`, "", 0)
+	ctx := context.Background()
+
+	names, err := client.RemoveMany(ctx, []string{"b", "missing", "a", "b"}, DryRun())
+	if err != nil || strings.Join(names, ",") != "b,a" {
+		t.Errorf("unexpected dry run result: %q, %v", names, err)
+	}
+
+	args := recordArgs(t, client)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_1={"error":{"code":"access_denied","message":"Access denied","exit_code":4}}`,
+		"MOCK_EXIT_1=4",
+	)
+	removed, err := client.RemoveMany(ctx, []string{"a", "b"})
+	if !errors.Is(err, ErrPolicyDenied) || !strings.Contains(err.Error(), `"a"`) {
+		t.Errorf("expected joined access_denied for a, got %v", err)
+	}
+	if strings.Join(removed, ",") != "b" {
+		t.Errorf("unexpected removed: %q", removed)
+	}
+	if got := args(); len(got) != 2 {
+		t.Errorf("expected both removals attempted, got %q", got)
+	}
+}
+
+func TestStore_PassesStdin(t *testing.T) {
+	bin := buildMockBinary(t)
+	// Store doesn't return JSON stdout on success
+	client := newMockClient(t, bin, "", "", 0)
+
+	err := client.Store(context.Background(), "api-key", "secret-value-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStore_AlreadyExists(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"already_exists","message":"Secret already exists: api-key","exit_code":5}}`,
+		5)
+
+	err := client.Store(context.Background(), "api-key", "value")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, ErrSecretAlreadyExists) {
+		t.Errorf("expected ErrSecretAlreadyExists, got %v", err)
+	}
+}
+
+func TestStore_Force(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+
+	err := client.Store(context.Background(), "api-key", "new-value", Force())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStore_WithTTL(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+
+	if err := client.Store(context.Background(), "token", "v", WithTTL(90*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json store token --ttl 5400s" {
+		t.Errorf("unexpected args: %q", got)
+	}
+	if err := client.Store(context.Background(), "token", "v", WithTTL(time.Millisecond)); err == nil {
+		t.Error("expected error for sub-second TTL")
+	}
+}
+
+func TestStoreAndRotate_WithMetadata(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"name":"db-url","value":"v","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-01-02T00:00:00Z",`+
+			`"tags":{"owner":"payments","env":"prod"},"description":"primary database"}`,
+		"", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_STDOUT_STORE=", `MOCK_STDOUT_ROTATE={"version":2}`,
+		`MOCK_STDOUT_LIST={"secrets":[{"name":"db-url","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-01-02T00:00:00Z",`+
+			`"tags":{"owner":"payments","env":"prod"},"description":"primary database"}]}`)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+	tags := WithTags(map[string]string{"owner": "payments", "env": "prod"})
+
+	if err := client.Store(ctx, "db-url", "v", tags, WithDescription("primary database"),
+		WithExpiry(time.Now().Add(time.Hour).Add(-500*time.Millisecond))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Rotate(ctx, "db-url", "v2", tags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	meta, err := client.GetMetadata(ctx, "db-url")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"--json store db-url --ttl 3600s --tag env=prod --tag owner=payments --description primary database",
+		"--json rotate db-url --tag env=prod --tag owner=payments",
+		"--json list",
+	}
+	if got := args(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected args: %q", got)
+	}
+	if meta.Tags["owner"] != "payments" || meta.Description != "primary database" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+
+	if err := client.Store(ctx, "x", "v", WithTTL(time.Hour), WithExpiry(time.Now().Add(time.Hour))); err == nil {
+		t.Error("expected error combining WithTTL and WithExpiry")
+	}
+	if err := client.Store(ctx, "x", "v", WithExpiry(time.Now().Add(-time.Minute))); err == nil {
+		t.Error("expected error for expiry in the past")
+	}
+	if err := client.Store(ctx, "x", "v", WithTags(map[string]string{"a=b": "c"})); err == nil {
+		t.Error("expected error for invalid tag key")
+	}
+}
+
+func TestListDetailed_TagAndModifiedFilters(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[`+
+		`{"name":"db-url","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-03-01T00:00:00Z","tags":{"team":"payments"}},`+
+		`{"name":"db-replica","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z","tags":{"team":"payments"}},`+
+		`{"name":"db-search","version":1,"created":"2025-04-01T00:00:00Z","modified":"2025-04-01T00:00:00Z","tags":{"team":"search"}},`+
+		`{"name":"api-key","version":1,"created":"2025-05-01T00:00:00Z","modified":"2025-05-01T00:00:00Z"}`+
+		`]}`, "", 0)
+	ctx := context.Background()
+
+	names, err := client.List(ctx, WithPrefix("db-"), WithTag("team", "payments"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(names, ",") != "db-url,db-replica" {
+		t.Errorf("unexpected tag filter result: %q", names)
+	}
+	names, _ = client.List(ctx, ModifiedSince(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)))
+	if strings.Join(names, ",") != "db-url,db-search,api-key" {
+		t.Errorf("unexpected modified filter result: %q", names)
+	}
+	names, _ = client.List(ctx, WithTag("team", "payments"), ModifiedSince(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)))
+	if strings.Join(names, ",") != "db-url" {
+		t.Errorf("unexpected combined filter result: %q", names)
+	}
+}
+
+func TestListIter(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"a","version":1},{"name":"b","version":1},{"name":"c","version":1}]}`, "", 0)
+	ctx := context.Background()
+
+	var names []string
+	client.ListIter(ctx)(func(entry ListResult, err error) bool {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names = append(names, entry.Name)
+		return entry.Name != "b"
+	})
+	if strings.Join(names, ",") != "a,b" {
+		t.Errorf("expected iteration to stop after b, got %q", names)
+	}
+
+	client = newMockClient(t, bin, "",
+		`{"error":{"code":"auth_failed","message":"Authentication failed","exit_code":2}}`, 2)
+	var errs []error
+	client.ListIter(ctx)(func(entry ListResult, err error) bool {
+		errs = append(errs, err)
+		return true
+	})
+	if len(errs) != 1 || !errors.Is(errs[0], ErrAuthFailed) {
+		t.Errorf("expected a single ErrAuthFailed, got %v", errs)
+	}
+}
+
+func TestStore_CLIExitsBeforeReadingStdin(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "",
+		`{"error":{"code":"already_exists","message":"Secret already exists: big","exit_code":5}}`, 5)
+	value := strings.Repeat("x", 1<<20)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := client.Store(ctx, "big", value)
+	if !errors.Is(err, ErrSecretAlreadyExists) {
+		t.Errorf("expected ErrSecretAlreadyExists, got %v", err)
+	}
+}
+
+func TestStore_WithStdinTimeout(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_SLEEP_MS=5000")
+	value := strings.Repeat("x", 1<<20)
+
+	start := time.Now()
+	err := client.Store(context.Background(), "big", value, WithStdinTimeout(100*time.Millisecond))
+	if !errors.Is(err, ErrStdinTimeout) {
+		t.Errorf("expected ErrStdinTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected call to fail fast, took %v", elapsed)
+	}
+}
+
+func TestWriteErrors_NeverContainValue(t *testing.T) {
+	const value = "hunter2-super-secret"
+	bin := buildMockBinary(t)
+	echoing := `{"error":{"code":"internal_error","message":"cannot parse ` + value + `","exit_code":1}}`
+	ctx := context.Background()
+
+	cases := []struct {
+		name string
+		call func(c *Client) error
+		mock []string
+	}{
+		{"store cli error", func(c *Client) error { return c.Store(ctx, "k", value) }, []string{"MOCK_STDERR=" + echoing, "MOCK_EXIT=1"}},
+		{"store scope", func(c *Client) error { return c.Store(ctx, "k", value, WithScope("s")) }, nil},
+		{"store ttl", func(c *Client) error { return c.Store(ctx, "k", value, WithTTL(time.Nanosecond)) }, nil},
+		{"store stdin timeout", func(c *Client) error {
+			return c.Store(ctx, "k", value+strings.Repeat("x", 1<<20), WithStdinTimeout(50*time.Millisecond))
+		}, []string{"MOCK_SLEEP_MS=3000"}},
+		{"store verify", func(c *Client) error {
+			c.writeVerify = true
+			return c.Store(ctx, "k", value)
+		}, []string{`MOCK_STDOUT_GET={"name":"k","value":"other","version":1}`}},
+		{"rotate cli error", func(c *Client) error { _, err := c.Rotate(ctx, "k", value); return err }, []string{"MOCK_STDERR=" + echoing, "MOCK_EXIT=1"}},
+		{"rotate scope", func(c *Client) error { _, err := c.Rotate(ctx, "k", value, WithScope("s")); return err }, nil},
+		{"rotate missing", func(c *Client) error { _, err := c.Rotate(ctx, "k", value); return err }, []string{`MOCK_STDOUT={"secrets":[]}`}},
+		{"store bytes cli error", func(c *Client) error { return c.StoreBytes(ctx, "k", []byte(value)) }, []string{"MOCK_STDERR=" + echoing, "MOCK_EXIT=1"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newMockClient(t, bin, "", "", 0)
+			client.extraEnv = append(client.extraEnv, tc.mock...)
+			err := tc.call(client)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if strings.Contains(err.Error(), value) {
+				t.Errorf("error leaks value: %v", err)
+			}
+			var ae *AuthyError
+			if errors.As(err, &ae) && strings.Contains(ae.Detail(), value) {
+				t.Errorf("error detail leaks value: %s", ae.Detail())
+			}
+		})
+	}
+}
+
+func TestStoreReader_StreamsStdin(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	calls := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	value := strings.Repeat("config-line\n", 1000)
+	if err := client.StoreReader(context.Background(), "app-config", strings.NewReader(value), Force()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json store app-config --force" {
+		t.Errorf("expected forced store, got %q", got)
+	}
+	if got := stdin(); got != value {
+		t.Errorf("expected %d bytes on stdin, got %d", len(value), len(got))
+	}
+}
+
+func TestStoreBytes_EncodesStdin(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	stdin := recordStdin(t, client)
+
+	if err := client.StoreBytes(context.Background(), "tls-key", []byte{0x30, 0x82, 0xff, 0x00, '\n'}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := stdin(); got != "MIL/AAo=" {
+		t.Errorf("expected base64 stdin, got %q", got)
+	}
+}
+
+func TestStoreBytes_WriteVerify(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.writeVerify = true
+	client.extraEnv = append(client.extraEnv, `MOCK_STDOUT_GET={"name":"tls-key","value":"MIL/AAo=","version":1}`)
+	ctx := context.Background()
+
+	if err := client.StoreBytes(ctx, "tls-key", []byte{0x30, 0x82, 0xff, 0x00, '\n'}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := client.StoreBytes(ctx, "tls-key", []byte{0x30, 0x82})
+	if !errors.Is(err, ErrWriteVerifyFailed) {
+		t.Errorf("expected ErrWriteVerifyFailed, got %v", err)
+	}
+}
+
+func TestGetBytes_DecodesValue(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"name":"tls-key","value":"MIL/AAo=","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}`,
+		"", 0)
+
+	data, err := client.GetBytes(context.Background(), "tls-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != "\x30\x82\xff\x00\n" {
+		t.Errorf("unexpected bytes: %x", data)
+	}
+}
+
+func TestList_ReturnsNames(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"db-url","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"},{"name":"api-key","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-01-02T00:00:00Z"}]}`,
+		"", 0)
+
+	names, err := client.List(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 names, got %d", len(names))
+	}
+	if names[0] != "db-url" {
+		t.Errorf("expected 'db-url', got %q", names[0])
+	}
+	if names[1] != "api-key" {
+		t.Errorf("expected 'api-key', got %q", names[1])
+	}
+}
+
+func TestList_WithScope(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"db-url","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}]}`,
+		"", 0)
+
+	names, err := client.List(context.Background(), WithScope("deploy"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("expected 1 name, got %d", len(names))
+	}
+	if names[0] != "db-url" {
+		t.Errorf("expected 'db-url', got %q", names[0])
+	}
+}
+
+func TestListDetailed_ReturnsMetadata(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"db-url","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"},{"name":"api-key","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-01-02T00:00:00Z"}]}`,
+		"", 0)
+
+	entries, err := client.ListDetailed(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	want := ListResult{
+		Name: "api-key", Version: 2, Created: "2025-01-01T00:00:00Z", Modified: "2025-01-02T00:00:00Z",
+		CreatedAt:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		ModifiedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(entries[1], want) {
+		t.Errorf("expected %+v, got %+v", want, entries[1])
+	}
+}
+
+func TestListStream_CallsFnPerEntry(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"a","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"},`+
+			`{"name":"b","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-01-02T00:00:00Z"},`+
+			`{"name":"c","version":3,"created":"2025-01-01T00:00:00Z","modified":"2025-01-03T00:00:00Z"}]}`,
+		"", 0)
+	ctx := context.Background()
+
+	var got []ListResult
+	err := client.ListStream(ctx, func(e ListResult) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 || got[1].Name != "b" || got[1].Version != 2 || got[1].ModifiedAt.Day() != 2 {
+		t.Errorf("unexpected entries: %+v", got)
+	}
+
+	stopErr := errors.New("stop")
+	calls := 0
+	err = client.ListStream(ctx, func(e ListResult) error {
+		calls++
+		return stopErr
+	})
+	if !errors.Is(err, stopErr) || calls != 1 {
+		t.Errorf("expected early stop after 1 call, got %d calls, err %v", calls, err)
+	}
+}
+
+func TestListStream_ReturnsCLIError(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "",
+		`{"error":{"code":"vault_not_initialized","message":"Vault not initialized","exit_code":7}}`, 7)
+
+	err := client.ListStream(context.Background(), func(ListResult) error { return nil })
+	if !errors.Is(err, ErrVaultNotFound) {
+		t.Errorf("expected ErrVaultNotFound, got %v", err)
+	}
+}
+
+func TestListStale_FiltersUnrotatedOldSecrets(t *testing.T) {
+	bin := buildMockBinary(t)
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	client := newMockClient(t, bin,
+		`{"secrets":[`+
+			`{"name":"old-key","version":1,"created":"2024-01-01T00:00:00Z","modified":"2024-01-01T00:00:00Z"},`+
+			`{"name":"rotated-key","version":3,"created":"2024-01-01T00:00:00Z","modified":"2024-01-01T00:00:00Z"},`+
+			`{"name":"fresh-key","version":1,"created":"`+recent+`","modified":"`+recent+`"}]}`,
+		"", 0)
+
+	stale, err := client.ListStale(context.Background(), 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stale) != 1 {
+		t.Fatalf("expected 1 stale secret, got %d", len(stale))
+	}
+	if stale[0].Name != "old-key" {
+		t.Errorf("expected 'old-key', got %q", stale[0].Name)
+	}
+}
+
+func TestVerify_ListsVault(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"db-url","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"},{"name":"api-key","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}]}`,
+		"", 0)
+
+	report, err := client.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Checked != 2 {
+		t.Errorf("expected 2 checked, got %d", report.Checked)
+	}
+	if len(report.Corrupt) != 0 {
+		t.Errorf("expected no corrupt secrets, got %v", report.Corrupt)
+	}
+}
+
+func TestVerify_DecryptAllReportsUnreadable(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"db-url","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}]}`,
+		"", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_GET=",
+		`MOCK_STDERR_GET={"error":{"code":"decryption_error","message":"Decryption error","exit_code":2}}`,
+		"MOCK_EXIT_GET=2",
+	)
+
+	report, err := client.Verify(context.Background(), VerifyDecryptAll())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[0] != "db-url" {
+		t.Errorf("expected [db-url] corrupt, got %v", report.Corrupt)
+	}
+}
+
+func TestList_PrefixAndGlobFilter(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"svc-api/db"},{"name":"svc-api/cache"},{"name":"svc-worker/db"}]}`,
+		"", 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	names, err := client.List(ctx, WithPrefix("svc-api/"), WithScope("deploy"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "svc-api/db" || names[1] != "svc-api/cache" {
+		t.Errorf("unexpected prefix result: %v", names)
+	}
+	if got := args(); got[0] != "--json list --scope deploy" {
+		t.Errorf("unexpected args: %q", got[0])
+	}
+
+	names, err = client.List(ctx, WithGlob("*/db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 2 || names[0] != "svc-api/db" || names[1] != "svc-worker/db" {
+		t.Errorf("unexpected glob result: %v", names)
+	}
+
+	if _, err := client.List(ctx, WithGlob("[")); err == nil {
+		t.Error("expected error for malformed glob")
+	}
+}
+
+func TestScope_GetPassesFlagAndWritesCheckPolicy(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"secret","version":1}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_POLICY={"scope":"deploy","secret":"db-url","allowed":true}`,
+		"MOCK_STDOUT_STORE=", "MOCK_STDOUT_REMOVE=")
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	if _, err := client.Get(ctx, "db-url", WithScope("deploy")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Store(ctx, "db-url", "v", WithScope("deploy"), Force()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Remove(ctx, "db-url", WithScope("deploy")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"--json get db-url --scope deploy",
+		"--json policy test --scope deploy db-url",
+		"--json store db-url --force",
+		"--json policy test --scope deploy db-url",
+		"--json remove db-url",
+	}
+	if got := args(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected args: %q", got)
+	}
+
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_POLICY={"scope":"deploy","secret":"db-url","allowed":false}`)
+	if _, err := client.Rotate(ctx, "db-url", "v", WithScope("deploy")); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("expected ErrPolicyDenied, got %v", err)
+	}
+	if got := args(); len(got) != 6 {
+		t.Errorf("denied rotate should stop after the policy check, got %q", got)
+	}
+}
+
+func TestCache_GetIsMemoizedAndInvalidated(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"secret","version":1}`, "", 0)
+	client.cache = newSecretCache(time.Minute, 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if v, err := client.Get(ctx, "db-url"); err != nil || v != "secret" {
+			t.Fatalf("Get = %q, %v", v, err)
+		}
+	}
+	if got := args(); len(got) != 1 {
+		t.Fatalf("expected 1 call with cache, got %d", len(got))
+	}
+
+	if _, err := client.Get(ctx, "db-url", WithScope("deploy")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 2 {
+		t.Errorf("expected scoped Get to miss the cache, got %d calls", len(got))
+	}
+
+	client.InvalidateCache("db-url")
+	if _, err := client.Get(ctx, "db-url"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 3 {
+		t.Errorf("expected Get after InvalidateCache to call the CLI, got %d calls", len(got))
+	}
+
+	if _, err := client.Remove(ctx, "db-url"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Get(ctx, "db-url"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 5 {
+		t.Errorf("expected Get after Remove to call the CLI, got %d calls", len(got))
+	}
+}
+
+func TestCache_KeyedByVault(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_1={"name":"db-url","value":"staging-value","version":1}`,
+		`MOCK_STDOUT_2={"name":"db-url","value":"prod-value","version":1}`)
+	client.cache = newSecretCache(time.Minute, 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if v, err := client.Get(ctx, "db-url", WithVaultScope("staging")); err != nil || v != "staging-value" {
+			t.Fatalf("staging Get = %q, %v", v, err)
+		}
+		if v, err := client.Get(ctx, "db-url", WithVaultScope("prod")); err != nil || v != "prod-value" {
+			t.Fatalf("prod Get = %q, %v", v, err)
+		}
+	}
+	want := []string{"--json --vault staging get db-url", "--json --vault prod get db-url"}
+	if got := args(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected one call per vault, got %q", got)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	created, version, err := client.Upsert(ctx, "db-url", "v1")
+	if err != nil || !created || version != 1 {
+		t.Errorf("expected creation at version 1, got %v %d %v", created, version, err)
+	}
+
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_STORE={"error":{"code":"already_exists","message":"Secret already exists: db-url","exit_code":5}}`,
+		"MOCK_EXIT_STORE=5",
+		`MOCK_STDOUT_ROTATE={"version":4}`)
+	created, version, err = client.Upsert(ctx, "db-url", "v2")
+	if err != nil || created || version != 4 {
+		t.Errorf("expected rotation to version 4, got %v %d %v", created, version, err)
+	}
+	want := "--json store db-url|--json store db-url|--json rotate db-url"
+	if got := args(); strings.Join(got, "|") != want {
+		t.Errorf("unexpected args: %q", got)
+	}
+
+	// Force must not turn an overwrite into a reported creation.
+	created, version, err = client.Upsert(ctx, "db-url", "v3", Force())
+	if err != nil || created || version != 4 {
+		t.Errorf("expected rotation with Force ignored, got %v %d %v", created, version, err)
+	}
+	want += "|--json store db-url|--json rotate db-url"
+	if got := args(); strings.Join(got, "|") != want {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestRotateIfVersion(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[{"name":"db-url","version":3}]}`, "", 0)
+	client.extraEnv = append(client.extraEnv, `MOCK_STDOUT_ROTATE={"version":4}`)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	version, err := client.RotateIfVersion(ctx, "db-url", "v", 3)
+	if err != nil || version != 4 {
+		t.Errorf("expected version 4, got %d %v", version, err)
+	}
+	if _, err := client.RotateIfVersion(ctx, "db-url", "v", 2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict, got %v", err)
+	}
+	if got := args(); strings.Join(got, "|") != "--json list|--json rotate db-url|--json list" {
+		t.Errorf("expected no rotate on conflict, got %q", got)
+	}
+	if _, err := client.RotateIfVersion(ctx, "missing", "v", 1); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+
+	client.extraEnv = append(client.extraEnv, `MOCK_STDOUT_ROTATE={"version":6}`)
+	version, err = client.RotateIfVersion(ctx, "db-url", "v", 3)
+	if !errors.Is(err, ErrVersionConflict) || version != 6 {
+		t.Errorf("expected a detected concurrent rotation, got %d %v", version, err)
+	}
+}
+
+func TestRollback_RotatesOldValueBackIn(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"old","version":1}`, "", 0)
+	client.extraEnv = append(client.extraEnv, `MOCK_STDOUT_ROTATE={"version":4}`)
+	args := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	if err := client.Rollback(context.Background(), "db-url", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := args()
+	if len(got) != 2 || got[0] != "--json get db-url --version 1" || got[1] != "--json rotate db-url" {
+		t.Errorf("unexpected args: %q", got)
+	}
+	if s := stdin(); s != "old" {
+		t.Errorf("expected old value on stdin, got %q", s)
+	}
+}
+
+func TestRenderTemplate_SubstitutesSecrets(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"postgres://db","version":1}`, "", 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	out, err := client.RenderTemplate(ctx, `url={{ secret "db-url" }} again={{ secret "db-url" }}`, WithScope("deploy"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "url=postgres://db again=postgres://db" {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json get db-url --scope deploy" {
+		t.Errorf("expected one get per secret, got %q", got)
+	}
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "app.yaml.tmpl")
+	outPath := filepath.Join(dir, "app.yaml")
+	os.WriteFile(in, []byte("db: {{ secret \"db-url\" }}\n"), 0o644)
+	if err := client.RenderTemplateFile(ctx, in, outPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(outPath)
+	if string(data) != "db: postgres://db\n" {
+		t.Errorf("unexpected file contents: %q", data)
+	}
+	if fi, _ := os.Stat(outPath); fi.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+}
+
+func TestRenderTemplate_MissingSecret(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "",
+		`{"error":{"code":"not_found","message":"Secret not found: nope","exit_code":3}}`, 3)
+
+	_, err := client.RenderTemplate(context.Background(), `{{ secret "nope" }}`)
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestCache_InvalidatedByStoreAndRotate(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"secret","version":1}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_STORE=", "MOCK_STDOUT_ROTATE=",
+		"MOCK_STDERR_ROTATE=Secret 'db-url' rotated to version 2.\n")
+	client.cache = newSecretCache(time.Minute, 0)
+	ctx := context.Background()
+
+	client.Get(ctx, "db-url")
+	if err := client.Store(ctx, "db-url", "new", Force()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, hit := client.cache.get(cacheKey{name: "db-url"}); hit {
+		t.Error("expected Store to invalidate the cached value")
+	}
+
+	client.Get(ctx, "db-url")
+	if _, err := client.Rotate(ctx, "db-url", "newer"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, hit := client.cache.get(cacheKey{name: "db-url"}); hit {
+		t.Error("expected Rotate to invalidate the cached value")
+	}
+}
+
+func TestCache_InvalidatedByImportAndBypassedByVerify(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"secret","version":1}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_IMPORT=",
+		`MOCK_STDOUT_LIST={"secrets":[{"name":"db-url","version":1}]}`)
+	client.cache = newSecretCache(time.Minute, 0)
+	ctx := context.Background()
+	key := cacheKey{name: "db-url"}
+
+	imports := map[string]func() error{
+		"ImportReader": func() error {
+			return client.ImportReader(ctx, strings.NewReader("DB_URL=new\n"), OnConflict(ConflictOverwrite))
+		},
+		"ImportDotenv": func() error { return client.ImportDotenv(ctx, ".env", OnConflict(ConflictOverwrite)) },
+		"ImportFrom":   func() error { return client.ImportFrom(ctx, "pass") },
+		"Import": func() error {
+			return client.Import(ctx, strings.NewReader("DB_URL=new\n"), FormatDotenv, Force())
+		},
+	}
+	for name, run := range imports {
+		client.Get(ctx, "db-url")
+		if err := run(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if _, _, hit := client.cache.get(key); hit {
+			t.Errorf("expected %s to invalidate the cached value", name)
+		}
+	}
+
+	client.Get(ctx, "db-url")
+	args := recordArgs(t, client)
+	report, err := client.Verify(ctx, VerifyDecryptAll())
+	if err != nil || len(report.Corrupt) != 0 {
+		t.Fatalf("unexpected result: %+v, %v", report, err)
+	}
+	if got := args(); len(got) != 2 || got[1] != "--json get db-url" {
+		t.Errorf("expected Verify to bypass the cache, got %q", got)
+	}
+}
+
+func TestCache_ExpiresAndSkipsNotFound(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"secret","version":1}`, "", 0)
+	client.cache = newSecretCache(20*time.Millisecond, 1)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	client.Get(ctx, "db-url")
+	time.Sleep(40 * time.Millisecond)
+	client.Get(ctx, "db-url")
+	if got := args(); len(got) != 2 {
+		t.Errorf("expected expired entry to be refetched, got %d calls", len(got))
+	}
+
+	missing := newMockClient(t, bin, "",
+		`{"error":{"code":"not_found","message":"Secret not found: x","exit_code":3}}`, 3)
+	missing.cache = newSecretCache(time.Minute, 0)
+	missingArgs := recordArgs(t, missing)
+	for i := 0; i < 2; i++ {
+		if _, err := missing.Get(ctx, "x"); !errors.Is(err, ErrSecretNotFound) {
+			t.Fatalf("expected ErrSecretNotFound, got %v", err)
+		}
+	}
+	if got := missingArgs(); len(got) != 2 {
+		t.Errorf("not_found must not be cached, got %d calls", len(got))
+	}
+}
+
+func TestGenerate_StoresRandomValueViaStdin(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	err := client.Generate(context.Background(), "api-key",
+		GenerateLength(24), GenerateAlphabet("abc"), GenerateForce())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json store api-key --force" {
+		t.Errorf("unexpected args: %q", got)
+	}
+	value := stdin()
+	if len(value) != 24 || strings.Trim(value, "abc") != "" {
+		t.Errorf("unexpected generated value %q", value)
+	}
+	if strings.Contains(strings.Join(args(), " "), value) {
+		t.Error("generated value leaked into args")
+	}
+
+	if err := client.Generate(context.Background(), "api-key", GenerateLength(0)); err == nil {
+		t.Error("expected error for zero length")
+	}
+}
+
+func TestGenerate_AppliesClientDefaults(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.scope = "deploy"
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_POLICY={"scope":"deploy","secret":"api-key","allowed":false}`)
+	args := recordArgs(t, client)
+
+	if err := client.Generate(context.Background(), "api-key"); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("expected the default scope's policy to deny, got %v", err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json policy test --scope deploy api-key" {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestImportDotenv_ConflictFail(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDERR_1=Skipping 'app-db-url' (already exists, use --force to overwrite)\n1 secret(s) imported, 1 skipped. (dry run)\n")
+	calls := recordArgs(t, client)
+
+	err := client.ImportDotenv(context.Background(), ".env", ImportPrefix("app-"), OnConflict(ConflictFail))
+	if !errors.Is(err, ErrSecretAlreadyExists) || !strings.Contains(err.Error(), "app-db-url") {
+		t.Errorf("expected ErrSecretAlreadyExists naming app-db-url, got %v", err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json import .env --prefix app- --dry-run" {
+		t.Errorf("expected only the dry run, got %q", got)
+	}
+}
+
+func TestImportDotenv_ScopeAndOverwrite(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_1=[dry-run] overwrite db-url = postgres://local...\n",
+		`MOCK_STDOUT_2={"scope":"staging","secret":"db-url","allowed":true}`)
+	calls := recordArgs(t, client)
+
+	err := client.ImportDotenv(context.Background(), ".env", ImportScope("staging"), OnConflict(ConflictOverwrite))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"--json import .env --force --dry-run",
+		"--json policy test --scope staging db-url",
+		"--json import .env --force",
+	}
+	if got := calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestImportDotenvResult_ReportsImportedAndSkipped(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_1={"secrets":[{"name":"db-url","version":1},{"name":"api-key","version":2}]}`,
+		"MOCK_STDERR_2=Skipping 'db-url' (already exists, use --force to overwrite)\n2 secret(s) imported, 1 skipped.\n",
+		`MOCK_STDOUT_3={"secrets":[{"name":"db-url","version":1},{"name":"api-key","version":3},{"name":"redis-url","version":1}]}`,
+	)
+
+	result, err := client.ImportDotenvResult(context.Background(), ".env")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(result.Imported, ","); got != "api-key,redis-url" {
+		t.Errorf("unexpected imported: %v", result.Imported)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0] != "db-url" {
+		t.Errorf("unexpected skipped: %v", result.Skipped)
+	}
+	if got := args(); len(got) != 3 || got[1] != "--json import .env" {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestRotate_ReadsVersionFromStderr(t *testing.T) {
+	bin := buildMockBinary(t)
+	// A concurrent writer has already moved the listing on to version 5.
+	client := newMockClient(t, bin, `{"secrets":[{"name":"db-url","version":5}]}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_ROTATE=",
+		"MOCK_STDERR_ROTATE=Secret 'db-url' rotated to version 4.\n")
+	args := recordArgs(t, client)
+
+	version, err := client.Rotate(context.Background(), "db-url", "new-value")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 4 {
+		t.Errorf("expected version 4, got %d", version)
+	}
+	if calls := args(); len(calls) != 1 {
+		t.Errorf("expected a single call, got %v", calls)
+	}
+}
+
+func TestRotate_VersionUnavailable(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[{"name":"db-url","version":4}]}`, "", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_STDOUT_ROTATE=")
+	args := recordArgs(t, client)
+
+	_, err := client.Rotate(context.Background(), "db-url", "new-value")
+	if err == nil || !strings.Contains(err.Error(), "did not report the new version") {
+		t.Errorf("expected missing version error, got %v", err)
+	}
+	if calls := args(); len(calls) != 1 {
+		t.Errorf("expected no follow-up calls, got %v", calls)
+	}
+}
+
+func TestRotate_ParsesVersionFromRotateOutput(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","version":7}`, "", 0)
+	args := recordArgs(t, client)
+
+	version, err := client.Rotate(context.Background(), "db-url", "new-value")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 7 {
+		t.Errorf("expected version 7, got %d", version)
+	}
+	if calls := args(); len(calls) != 1 {
+		t.Errorf("expected a single call, got %v", calls)
+	}
+}
+
+func TestRun_CapturesOutput(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "child output\n", "child warning\n", 3)
+
+	result, err := client.Run(context.Background(), []string{"deploy.sh"}, WithScope("deploy"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", result.ExitCode)
+	}
+	if string(result.Stdout) != "child output\n" {
+		t.Errorf("unexpected stdout: %q", result.Stdout)
+	}
+	if string(result.Stderr) != "child warning\n" {
+		t.Errorf("unexpected stderr: %q", result.Stderr)
+	}
+}
+
+func TestRun_StreamsOutput(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "child output\n", "child warning\n", 0)
+
+	var out bytes.Buffer
+	result, err := client.Run(context.Background(), []string{"deploy.sh"}, WithStdout(&out))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "child output\n" {
+		t.Errorf("expected streamed stdout, got %q", out.String())
+	}
+	if result.Stdout != nil {
+		t.Errorf("expected no collected stdout, got %q", result.Stdout)
+	}
+	if string(result.Stderr) != "child warning\n" {
+		t.Errorf("expected stderr to still be collected, got %q", result.Stderr)
+	}
+}
+
+func TestRun_InteractiveExclusiveWithStdout(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+
+	_, err := client.Run(context.Background(), []string{"psql"}, WithInteractive(), WithStdout(io.Discard))
+	if err == nil {
+		t.Fatal("expected error combining WithInteractive and WithStdout")
+	}
+}
+
+func TestRun_InteractiveReturnsExitCode(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 4)
+
+	result, err := client.Run(context.Background(), []string{"psql"}, WithInteractive())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 4 || result.Stdout != nil {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestRun_AuthyErrorIsReturned(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"auth_failed","message":"Authentication failed: wrong passphrase","exit_code":2}}`,
+		2)
+
+	_, err := client.Run(context.Background(), []string{"deploy.sh"})
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestRun_WithEnvMapping(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"prod/db-url":"postgres://localhost/mydb"}`, "", 0)
+
+	mapping := func(name string) string {
+		return strings.ToUpper(strings.NewReplacer("/", "_", "-", "_").Replace(name))
+	}
+	result, err := client.Run(context.Background(),
+		[]string{"sh", "-c", `test "$PROD_DB_URL" = "postgres://localhost/mydb"`},
+		WithScope("deploy"), WithEnvMapping(mapping))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("expected mapped env var in child, got exit code %d", result.ExitCode)
+	}
+}
+
+func TestEnvMapAndInjectEnv(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"DB_URL":"postgres://localhost/mydb"}`, "", 0)
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	vars, err := client.EnvMap(ctx, "deploy", WithUppercase(), WithReplaceDash('_'))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vars) != 1 || vars["DB_URL"] != "postgres://localhost/mydb" {
+		t.Errorf("unexpected vars: %v", vars)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json env --format json --scope deploy --uppercase --replace-dash _" {
+		t.Errorf("unexpected args: %q", got)
+	}
+
+	t.Setenv("DB_URL", "")
+	if err := client.InjectEnv(ctx, "deploy"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := os.Getenv("DB_URL"); got != "postgres://localhost/mydb" {
+		t.Errorf("expected DB_URL to be set, got %q", got)
+	}
+}
+
+func TestEnvMap_UnscopedUsesExport(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `[{"name":"DB_URL","value":"postgres://localhost/mydb","version":1}]`, "", 0)
+	// The CLI's env refuses to run without a scope or a .authy.toml.
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_ENV={"error":{"code":"error","message":"No scope provided","exit_code":1}}`,
+		"MOCK_EXIT_ENV=1",
+	)
+	args := recordArgs(t, client)
+
+	vars, err := client.EnvMap(context.Background(), "", WithUppercase(), WithVaultScope("staging"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vars) != 1 || vars["DB_URL"] != "postgres://localhost/mydb" {
+		t.Errorf("unexpected vars: %v", vars)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json --vault staging export --format json --uppercase" {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestEnvMap_PassesCallConfig(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"DB_URL":"postgres://localhost/mydb"}`, "", 0)
+	args := recordArgs(t, client)
+
+	if _, err := client.EnvMap(context.Background(), "deploy", WithVaultScope("staging")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json --vault staging env --format json --scope deploy" {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestRun_WithStdinAndExtraEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `[{"name":"db-url","value":"postgres://localhost/mydb"}]`, "", 0)
+
+	var stdout bytes.Buffer
+	result, err := client.Run(context.Background(),
+		[]string{"sh", "-c", `read line; printf '%s %s %s' "$line" "$REGION" "$DB_URL"`},
+		WithEnvMapping(func(name string) string { return strings.ToUpper(strings.ReplaceAll(name, "-", "_")) }),
+		WithStdin(strings.NewReader("hello\n")),
+		WithExtraEnv([]string{"REGION=eu-west-1", "DB_URL=overridden"}),
+		WithStdout(&stdout))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Fatalf("unexpected exit code %d", result.ExitCode)
+	}
+	if got := stdout.String(); got != "hello eu-west-1 postgres://localhost/mydb" {
+		t.Errorf("unexpected output: %q", got)
+	}
+
+	_, err = client.Run(context.Background(), []string{"true"}, WithInteractive(), WithStdin(strings.NewReader("")))
+	if err == nil {
+		t.Error("expected WithInteractive to reject WithStdin")
+	}
+}
+
+func TestRun_ReportsSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires POSIX signals")
+	}
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{}`, "", 0)
+
+	result, err := client.Run(context.Background(),
+		[]string{"sh", "-c", "kill -KILL $$"},
+		WithScope("deploy"), WithEnvMapping(strings.ToUpper))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Signaled || result.Signal != syscall.SIGKILL {
+		t.Errorf("expected SIGKILL, got Signaled=%v Signal=%v", result.Signaled, result.Signal)
+	}
+}
+
+func TestWithOverride_RemovesNewSecret(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_GET={"error":{"code":"not_found","message":"Secret not found: flag","exit_code":3}}`,
+		"MOCK_EXIT_GET=3",
+	)
+	calls := recordArgs(t, client)
+
+	ran := false
+	err := client.WithOverride(context.Background(), "flag", "on", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ran {
+		t.Error("expected callback to run")
+	}
+	want := []string{"--json get flag", "--json store flag --force", "--json remove flag"}
+	got := calls()
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected calls %q, got %q", want, got)
+	}
+}
+
+func TestWithOverride_RestoresPriorValue(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"name":"flag","value":"off","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}`,
+		"", 0)
+	client.extraEnv = append(client.extraEnv, `MOCK_STDOUT_ROTATE={"version":2}`)
+	calls := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	fnErr := errors.New("boom")
+	err := client.WithOverride(context.Background(), "flag", "on", func(ctx context.Context) error {
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+	want := []string{"--json get flag", "--json rotate flag", "--json rotate flag"}
+	if got := calls(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected the override and restore to rotate, got %q", got)
+	}
+	if got := stdin(); got != "off" {
+		t.Errorf("expected the restore to write the prior value, got %q", got)
+	}
+}
+
+func TestExportDotenv_WritesOutput(t *testing.T) {
+	bin := buildMockBinary(t)
+	dotenv := "api-key=abc123\ndb-url=\"postgres://localhost/my db\"\n"
+	client := newMockClient(t, bin, dotenv, "", 0)
+	calls := recordArgs(t, client)
+
+	var buf bytes.Buffer
+	if err := client.ExportDotenv(context.Background(), &buf, WithScope("deploy")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != dotenv {
+		t.Errorf("expected %q, got %q", dotenv, buf.String())
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json export --format env --scope deploy" {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestExportDotenvFile_QuoteAlways(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `[{"name":"API_KEY","value":"abc\"123"},{"name":"DB_URL","value":"postgres://localhost/my db"}]`, "", 0)
+	// The CLI's env refuses to run without a scope or a .authy.toml.
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_ENV={"error":{"code":"error","message":"No scope provided","exit_code":1}}`,
+		"MOCK_EXIT_ENV=1",
+	)
+	calls := recordArgs(t, client)
+	path := filepath.Join(t.TempDir(), ".env")
+
+	if err := client.ExportDotenvFile(context.Background(), path, WithQuoting(QuoteAlways)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "API_KEY=\"abc\\\"123\"\nDB_URL=\"postgres://localhost/my db\"\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+	if info, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0o600) {
+		t.Errorf("expected mode 0600, got %v (%v)", info.Mode(), err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json export --format json" {
+		t.Errorf("unexpected args: %q", got)
+	}
+
+	if err := client.ExportDotenvFile(context.Background(), path, WithQuoting(QuoteAlways), WithScope("deploy")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls(); len(got) != 2 || got[1] != "--json export --format json --scope deploy" {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestImportReader_PipesStdin(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	calls := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	env := "DB_URL=postgres://localhost/mydb\nAPI_KEY=abc123\n"
+	if err := client.ImportReader(context.Background(), strings.NewReader(env)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json import -" {
+		t.Errorf("expected import from stdin, got %q", got)
+	}
+	if got := stdin(); got != env {
+		t.Errorf("expected stdin %q, got %q", env, got)
+	}
+}
+
+func TestStore_WriteVerify(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"name":"api-key","value":"secret-value-123","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}`,
+		"", 0)
+	client.writeVerify = true
+
+	if err := client.Store(context.Background(), "api-key", "secret-value-123\n"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := client.Store(context.Background(), "api-key", "other-value", Force())
+	if !errors.Is(err, ErrWriteVerifyFailed) {
+		t.Errorf("expected ErrWriteVerifyFailed, got %v", err)
+	}
+}
+
+func TestCredentialsInEnv(t *testing.T) {
+	client, err := New(
+		WithBinary("/bin/true"),
+		WithPassphrase("my-passphrase"),
+		WithKeyfile("/path/to/keyfile"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	foundPassphrase := false
+	foundKeyfile := false
+	for _, env := range client.extraEnv {
+		if env == "AUTHY_PASSPHRASE=my-passphrase" {
+			foundPassphrase = true
+		}
+		if env == "AUTHY_KEYFILE=/path/to/keyfile" {
+			foundKeyfile = true
+		}
+	}
+
+	if !foundPassphrase {
+		t.Error("expected AUTHY_PASSPHRASE in extraEnv")
+	}
+	if !foundKeyfile {
+		t.Error("expected AUTHY_KEYFILE in extraEnv")
+	}
+}
+
+func TestTokenInEnv(t *testing.T) {
+	client, err := New(WithBinary("/bin/true"), WithToken("authy_v1.abc"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found := false
+	for _, env := range client.extraEnv {
+		if env == "AUTHY_TOKEN=authy_v1.abc" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected AUTHY_TOKEN in extraEnv")
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"invalid_token","message":"Invalid session token","exit_code":6}}`,
+		6)
+
+	_, err := client.Get(context.Background(), "db-url")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestWithEnv_LastWins(t *testing.T) {
+	client, err := New(
+		WithBinary("/bin/true"),
+		WithPassphrase("typed"),
+		WithEnv("AUTHY_VAULT_DIR", "/srv/vault"),
+		WithEnv("AUTHY_PASSPHRASE", "override"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cmd, cleanup, err := client.command(context.Background(), []string{"list"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+	env := cmd.Env
+	var passphrases []string
+	foundCustom := false
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "AUTHY_PASSPHRASE=") {
+			passphrases = append(passphrases, kv)
+		}
+		if kv == "AUTHY_VAULT_DIR=/srv/vault" {
+			foundCustom = true
+		}
+	}
+	if len(passphrases) != 1 || passphrases[0] != "AUTHY_PASSPHRASE=override" {
+		t.Errorf("expected single overridden passphrase, got %q", passphrases)
+	}
+	if !foundCustom {
+		t.Error("expected AUTHY_VAULT_DIR in subprocess env")
+	}
+}
+
+func TestWithVault_PrecedesSubcommand(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"v","version":1}`, "", 0)
+	client.vault = "prod"
+	args := recordArgs(t, client)
+	ctx := context.Background()
+
+	if _, err := client.Get(ctx, "db-url", WithScope("deploy")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Get(ctx, "db-url", WithVaultScope("staging")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"--json --vault prod get db-url --scope deploy",
+		"--json --vault staging get db-url",
+	}
+	if got := args(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected args: %q", got)
+	}
+}
+
+func TestNewFromProfile(t *testing.T) {
+	bin := buildMockBinary(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.Mkdir(filepath.Join(home, ".authy"), 0o700)
+	profiles := "# shared profiles\n" +
+		"[dev]\nscope = \"dev\"\n\n" +
+		"[prod]\n" +
+		"binary = \"" + bin + "\"\n" +
+		"vault = 'prod'  # named vault\n" +
+		"keyfile = \"~/.authy/keys/prod.key\"\n" +
+		"scope = \"deploy\"\n"
+	os.WriteFile(filepath.Join(home, ".authy", "profiles.toml"), []byte(profiles), 0o600)
+
+	client, err := NewFromProfile("prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.binary != bin || client.vault != "prod" || client.scope != "deploy" {
+		t.Errorf("profile not applied: binary=%q vault=%q scope=%q", client.binary, client.vault, client.scope)
+	}
+	wantKey := "AUTHY_KEYFILE=" + filepath.Join(home, ".authy", "keys", "prod.key")
+	if len(client.extraEnv) != 1 || client.extraEnv[0] != wantKey {
+		t.Errorf("unexpected env: %q", client.extraEnv)
+	}
+
+	client.extraEnv = append(client.extraEnv, `MOCK_STDOUT={"name":"db-url","value":"v","version":1}`, "MOCK_EXIT=0")
+	args := recordArgs(t, client)
+	ctx := context.Background()
+	client.Get(ctx, "db-url")
+	client.Get(ctx, "db-url", WithScope("admin"))
+	want := "--json --vault prod get db-url --scope deploy|--json --vault prod get db-url --scope admin"
+	if got := args(); strings.Join(got, "|") != want {
+		t.Errorf("unexpected args: %q", got)
+	}
+
+	if _, err := NewFromProfile("staging"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("expected ErrProfileNotFound, got %v", err)
+	}
+	os.WriteFile(filepath.Join(home, "bad.toml"), []byte("[dev]\nscop = \"x\"\n"), 0o600)
+	if _, err := LoadProfile(filepath.Join(home, "bad.toml"), "dev"); err == nil || !strings.Contains(err.Error(), "unknown profile key") {
+		t.Errorf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestIssueToken(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"token":"authy_v1.abc","session_id":"0123abcd","scope":"ci","run_only":true,"expires":"2025-06-01T12:00:00+00:00"}`,
+		"", 0)
+	args := recordArgs(t, client)
+
+	tok, err := client.IssueToken(context.Background(), 90*time.Minute, "ci", TokenLabel("nightly"), TokenRunOnly())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tok.Value != "authy_v1.abc" || tok.SessionID != "0123abcd" || tok.Scope != "ci" || !tok.RunOnly {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+	if !tok.Expires.Equal(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry: %v", tok.Expires)
+	}
+	if strings.Contains(tok.String(), tok.Value) {
+		t.Errorf("String leaked the token: %q", tok.String())
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json session create --scope ci --ttl 5400s --label nightly --run-only" {
+		t.Errorf("unexpected args: %q", got)
+	}
+	if _, err := client.IssueToken(context.Background(), time.Millisecond, "ci"); err == nil {
+		t.Error("expected error for sub-second ttl")
+	}
+}
+
+func TestGlobalArgs_Order(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[]}`, "", 0)
+	client.configFile = "/etc/authy.toml"
+	client.vault = "prod"
+	args := recordArgs(t, client)
+
+	if _, err := client.List(context.Background(), WithScope("deploy")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); got[0] != "--json --config /etc/authy.toml --vault prod list --scope deploy" {
+		t.Errorf("unexpected args: %q", got[0])
+	}
+}
+
+func TestWithPassphraseFD_UsesPipe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("passphrase fd is not supported on windows")
+	}
+	bin := buildMockBinary(t)
+	client, err := New(WithBinary(bin), WithPassphrase("my-passphrase"), WithPassphraseFD())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, env := range client.extraEnv {
+		if strings.HasPrefix(env, "AUTHY_PASSPHRASE=") {
+			t.Error("expected no AUTHY_PASSPHRASE in extraEnv")
+		}
+	}
+	calls := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+	passPath := filepath.Join(t.TempDir(), "passphrase.log")
+	client.extraEnv = append(client.extraEnv, "MOCK_PASSPHRASE_FILE="+passPath)
+
+	if err := client.Store(context.Background(), "api-key", "secret-value"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json --passphrase-fd 3 store api-key" {
+		t.Errorf("unexpected args: %q", got)
+	}
+	if got, _ := os.ReadFile(passPath); string(got) != "my-passphrase" {
+		t.Errorf("expected passphrase on fd 3, got %q", got)
+	}
+	if got := stdin(); got != "secret-value" {
+		t.Errorf("expected value on stdin, got %q", got)
+	}
+}
+
+func TestWithPassphraseFunc_ResolvesPerCall(t *testing.T) {
+	bin := buildMockBinary(t)
+	calls := 0
+	client, err := New(WithBinary(bin), WithPassphrase("static"),
+		WithPassphraseFunc(func(ctx context.Context) (string, error) {
+			calls++
+			if calls > 1 {
+				return "", errors.New("kms unavailable")
+			}
+			return "fresh", nil
+		}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, env := range client.extraEnv {
+		if strings.HasPrefix(env, "AUTHY_PASSPHRASE=") {
+			t.Error("expected no AUTHY_PASSPHRASE in extraEnv")
+		}
+	}
+
+	cmd, cleanup, err := client.command(context.Background(), []string{"list"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cleanup()
+	var got []string
+	for _, env := range cmd.Env {
+		if strings.HasPrefix(env, "AUTHY_PASSPHRASE=") {
+			got = append(got, env)
+		}
+	}
+	if len(got) != 1 || got[0] != "AUTHY_PASSPHRASE=fresh" {
+		t.Errorf("unexpected passphrase env: %q", got)
+	}
+
+	if _, err := client.List(context.Background()); err == nil || !strings.Contains(err.Error(), "kms unavailable") {
+		t.Errorf("expected callback error, got %v", err)
+	}
+}
+
+func TestWithLogger_ReportsInvocations(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`,
+		3)
+	var events []Event
+	client.logger = func(ctx context.Context, event Event) {
+		events = append(events, event)
+	}
+
+	_, _ = client.Get(context.Background(), "db-url")
+	client.redactNames = true
+	_, _ = client.Get(context.Background(), "db-url")
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Subcommand != "get" || events[0].Secret != "db-url" {
+		t.Errorf("unexpected event: %+v", events[0])
+	}
+	if events[0].ExitCode != 3 || events[0].ErrorCode != "not_found" {
+		t.Errorf("expected not_found exit 3, got %+v", events[0])
+	}
+	if events[1].Secret != "" {
+		t.Errorf("expected redacted secret name, got %q", events[1].Secret)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	bin := buildMockBinary(t)
+	// Use a mock that sleeps — but since our mock doesn't sleep,
+	// we test with an already-cancelled context.
+	client := newMockClient(t, bin, "", "", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // cancel immediately
+
+	_, err := client.Get(ctx, "any-key")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBinaryNotFound(t *testing.T) {
+	client := &Client{binary: filepath.Join(t.TempDir(), "missing-authy")}
+
+	_, err := client.Get(context.Background(), "any-key")
+	if !errors.Is(err, ErrBinaryNotFound) {
+		t.Fatalf("expected ErrBinaryNotFound, got %v", err)
+	}
+}
+
+func TestContextCancellation_GracefulSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM is not supported on windows")
+	}
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.cancelSignal = syscall.SIGTERM
+	client.cancelGrace = 5 * time.Second
+	termFile := filepath.Join(t.TempDir(), "term.log")
+	client.extraEnv = append(client.extraEnv, "MOCK_SLEEP_MS=10000", "MOCK_TERM_FILE="+termFile)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := client.Get(ctx, "any-key"); err == nil {
+		t.Fatal("expected error from cancelled context, got nil")
+	}
+	if data, _ := os.ReadFile(termFile); string(data) != "terminated" {
+		t.Error("expected the subprocess to receive SIGTERM")
+	}
+}
+
+func TestWithTimeout_AbortsHungCall(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_SLEEP_MS=5000")
+
+	start := time.Now()
+	_, err := client.Get(context.Background(), "db-url", WithTimeout(100*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout and context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected call to abort quickly, took %v", elapsed)
+	}
+}
+
+func TestWithDefaultTimeout(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_SLEEP_MS=5000")
+	client.timeout = 100 * time.Millisecond
+
+	if _, err := client.List(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	// The caller's own deadline is not reported as ErrTimeout.
+	client.timeout = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := client.List(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected only context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestWithMaxConcurrentProcesses_WaitsForSlot(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"v","version":1}`, "", 0)
+	client.procs = make(chan struct{}, 1)
+	args := recordArgs(t, client)
+
+	client.procs <- struct{}{} // occupy the only slot
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Get(ctx, "db-url"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded while waiting, got %v", err)
+	}
+	if got := args(); got != nil {
+		t.Errorf("expected no process to start, got %q", got)
+	}
+
+	<-client.procs
+	if _, err := client.Get(context.Background(), "db-url"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.procs) != 0 {
+		t.Error("expected slot to be released after the call")
+	}
+}
+
+func TestWrites_AreSerialized(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_SLEEP_MS=150")
+	ctx := context.Background()
+
+	start := time.Now()
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			errs <- client.Store(ctx, fmt.Sprintf("key-%d", i), "v")
+		}(i)
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond {
+		t.Errorf("expected writes to run one at a time, took %v", elapsed)
+	}
+}
+
+func TestWrites_SerializeTokenIssueWithStore(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_SLEEP_MS=150",
+		`MOCK_STDOUT_SESSION={"token":"authy_v1.abc","session_id":"s1","scope":"deploy","run_only":false,"expires":"2030-01-01T00:00:00Z"}`)
+	ctx := context.Background()
+
+	start := time.Now()
+	errs := make(chan error, 2)
+	go func() {
+		_, err := client.IssueToken(ctx, time.Hour, "deploy")
+		errs <- err
+	}()
+	go func() {
+		errs <- client.Store(ctx, "db-url", "v")
+	}()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("expected the token issue and store to run one at a time, took %v", elapsed)
+	}
+}
+
+func TestIsWrite(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"store", "x"}, true},
+		{[]string{"rekey"}, true},
+		{[]string{"policy", "create", "deploy"}, true},
+		{[]string{"policy", "test", "--scope", "deploy", "x"}, false},
+		{[]string{"session", "revoke-all"}, true},
+		{[]string{"session", "list"}, false},
+		{[]string{"get", "x"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isWrite(tt.args); got != tt.want {
+			t.Errorf("isWrite(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetry_RetriesReads(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"internal_error","message":"vault locked","exit_code":1}}`,
+		1)
+	client.retry = retryPolicy{attempts: 3, backoff: time.Millisecond}
+	calls := recordArgs(t, client)
+
+	_, err := client.Get(context.Background(), "db-url")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if got := calls(); len(got) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(got))
+	}
+}
+
+func TestWithRetry_SkipsWritesWithoutOptIn(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"internal_error","message":"vault locked","exit_code":1}}`,
+		1)
+	client.retry = retryPolicy{attempts: 3, backoff: time.Millisecond}
+	calls := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	_ = client.Store(context.Background(), "api-key", "value")
+	if got := calls(); len(got) != 1 {
+		t.Errorf("expected 1 attempt without AllowRetry, got %d", len(got))
+	}
+
+	_ = client.Store(context.Background(), "api-key", "value", AllowRetry())
+	if got := calls(); len(got) != 4 {
+		t.Errorf("expected 3 more attempts with AllowRetry, got %d", len(got)-1)
+	}
+	if got := stdin(); got != "value" {
+		t.Errorf("expected stdin to be replayed, got %q", got)
+	}
+}
+
+func TestWithRetry_RetriesIOErrors(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[]}`,
+		`{"error":{"code":"io_error","message":"IO error: No such file or directory (os error 2)","exit_code":1}}`,
+		1)
+	client.extraEnv = append(client.extraEnv, "MOCK_EXIT_2=0", "MOCK_STDERR_2=")
+	client.retry = retryPolicy{attempts: 3, backoff: time.Millisecond}
+	calls := recordArgs(t, client)
+
+	if _, err := client.List(context.Background()); err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(got))
+	}
+}
+
+func TestWithRetry_DoesNotRetryNotFound(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`,
+		3)
+	client.retry = retryPolicy{attempts: 3, backoff: time.Millisecond}
+	calls := recordArgs(t, client)
+
+	_, err := client.Get(context.Background(), "db-url")
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+	if got := calls(); len(got) != 1 {
+		t.Errorf("expected 1 attempt, got %d", len(got))
+	}
+}
+
+func TestRemove_Success(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+
+	removed, err := client.Remove(context.Background(), "db-url")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !removed {
+		t.Error("expected removed=true")
+	}
+}
+
+func TestRemove_NotFound(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"not_found","message":"Secret not found: db-url","exit_code":3}}`,
+		3)
+
+	_, err := client.Remove(context.Background(), "db-url")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	calls := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	if err := client.Rename(context.Background(), "old-name", "new-name"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls(); len(got) != 1 || got[0] != "--json rename old-name new-name" {
+		t.Errorf("unexpected args: %q", got)
+	}
+	if got := stdin(); got != "" {
+		t.Errorf("expected no stdin, got %q", got)
+	}
+}
+
+func TestRename_DestinationExists(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"already_exists","message":"Secret already exists: new-name","exit_code":5}}`,
+		5)
+
+	err := client.Rename(context.Background(), "old-name", "new-name")
+	if !errors.Is(err, ErrSecretAlreadyExists) {
+		t.Errorf("expected ErrSecretAlreadyExists, got %v", err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+
+	if err := client.Copy(context.Background(), "db-url", "staging", "prod", Force()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); got[0] != "--json copy db-url --from-scope staging --to-scope prod --force" {
+		t.Errorf("unexpected args: %q", got[0])
+	}
+}
+
+func TestCopy_UnsupportedWithoutCopySubcommand(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDERR_COPY=error: unrecognized subcommand 'copy'\n\nUsage: authy [OPTIONS] <COMMAND>\n",
+		"MOCK_EXIT_COPY=2",
+	)
+	args := recordArgs(t, client)
+
+	err := client.Copy(context.Background(), "db-url", "staging", "prod", Force())
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected errors.ErrUnsupported, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "copy") {
+		t.Errorf("error does not name the subcommand: %v", err)
+	}
+	if got := args(); len(got) != 1 {
+		t.Errorf("expected only the copy call, got %q", got)
+	}
+}
+
+func TestCopyAs_CarriesMetadata(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"name":"db-url","value":"postgres://x","version":3,"created":"2025-01-01T00:00:00Z","modified":"2025-01-02T00:00:00Z","tags":{"team":"core"},"description":"primary db"}`,
+		"", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_STDOUT_STORE=")
+	args := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	if err := client.CopyAs(context.Background(), "db-url", "db-url-backup", WithDescription("backup")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"--json get db-url", "--json store db-url-backup --tag team=core --description backup"}
+	if got := args(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected calls: %q", got)
+	}
+	if got := stdin(); got != "postgres://x" {
+		t.Errorf("unexpected stdin: %q", got)
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"auth_failed","message":"Authentication failed: wrong passphrase","exit_code":2}}`,
+		2)
+
+	_, err := client.Get(context.Background(), "db-url")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestPolicyDenied(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"access_denied","message":"Access denied","exit_code":4}}`,
+		4)
+
+	_, err := client.Get(context.Background(), "db-url")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("expected ErrPolicyDenied, got %v", err)
+	}
+}
+
+func TestVaultNotFound(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"vault_not_initialized","message":"Vault not initialized","exit_code":7}}`,
+		7)
+
+	_, err := client.Get(context.Background(), "db-url")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, ErrVaultNotFound) {
+		t.Errorf("expected ErrVaultNotFound, got %v", err)
+	}
+}
+
+func TestUnknownError_KeepsRawStderr(t *testing.T) {
+	bin := buildMockBinary(t)
+	stderr := `{"error":{"code":"quota_exceeded","message":"Quota exceeded","exit_code":9,"hint":"upgrade"}}`
+	client := newMockClient(t, bin, "", stderr, 9)
+
+	_, err := client.Get(context.Background(), "db-url")
+	var ae *AuthyError
+	if !errors.As(err, &ae) {
+		t.Fatalf("expected *AuthyError, got %v", err)
+	}
+	if ae.Error() != "Quota exceeded" {
+		t.Errorf("Error() should prefer Message, got %q", ae.Error())
+	}
+	if string(ae.Raw) != stderr {
+		t.Errorf("unexpected Raw: %q", ae.Raw)
+	}
+	if !strings.Contains(ae.Detail(), `"hint":"upgrade"`) {
+		t.Errorf("Detail() should include raw stderr, got %q", ae.Detail())
+	}
+}
+
+func TestAuthyError_RecordsArgsAndProcessError(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "boom", 1)
+	client.vault = "prod"
+
+	_, err := client.Get(context.Background(), "db-url", WithScope("deploy"))
+	var ae *AuthyError
+	if !errors.As(err, &ae) {
+		t.Fatalf("expected *AuthyError, got %v", err)
+	}
+	if strings.Join(ae.Args, " ") != "get db-url --scope deploy" {
+		t.Errorf("unexpected Args: %q", ae.Args)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("expected wrapped *exec.ExitError, got %v", ae.Err)
+	}
+	if !strings.Contains(ae.Detail(), "(command: authy get db-url --scope deploy)") {
+		t.Errorf("Detail() should include the command, got %q", ae.Detail())
+	}
+
+	client.redactNames = true
+	_, err = client.Get(context.Background(), "db-url")
+	if !errors.As(err, &ae) || strings.Join(ae.Args, " ") != "get [REDACTED]" {
+		t.Errorf("expected redacted name in Args, got %v", ae.Args)
+	}
+}
+
+func TestRedactNames_ByCommandShape(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		"",
+		`{"error":{"code":"not_found","message":"Secret not found","exit_code":3}}`,
+		3)
+	client.redactNames = true
+	var events []Event
+	client.logger = func(ctx context.Context, event Event) {
+		events = append(events, event)
+	}
+	tracer := &recordingTracer{}
+	client.tracer = tracer
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"get", "db-url"}, "get [REDACTED]"},
+		{[]string{"store", "db-url", "--force"}, "store [REDACTED] --force"},
+		{[]string{"remove", "db-url"}, "remove [REDACTED]"},
+		{[]string{"rotate", "db-url"}, "rotate [REDACTED]"},
+		{[]string{"rename", "db-url", "db-url-old"}, "rename [REDACTED] [REDACTED]"},
+		{[]string{"copy", "db-url", "--from-scope", "a", "--to-scope", "b"}, "copy [REDACTED] --from-scope a --to-scope b"},
+		{[]string{"policy", "test", "--scope", "deploy", "db-url"}, "policy test --scope deploy [REDACTED]"},
+		{[]string{"list"}, "list"},
+	}
+	for _, tt := range tests {
+		_, err := client.Exec(context.Background(), tt.args, nil)
+		var ae *AuthyError
+		if !errors.As(err, &ae) {
+			t.Fatalf("%s: expected *AuthyError, got %v", tt.args[0], err)
+		}
+		if got := strings.Join(ae.Args, " "); got != tt.want {
+			t.Errorf("Args = %q, want %q", got, tt.want)
+		}
+	}
+	for _, e := range events {
+		if e.Secret != "" {
+			t.Errorf("%s event leaked name %q", e.Subcommand, e.Secret)
+		}
+	}
+	for _, span := range tracer.spans {
+		if name, ok := span.attrs["authy.secret"]; ok {
+			t.Errorf("%s span leaked name %v", span.name, name)
+		}
+	}
+
+	if _, err := client.Exec(context.Background(), nil, nil); err == nil {
+		t.Error("expected an error for empty args")
+	}
+
+	client.redactNames = false
+	events = nil
+	client.Exec(context.Background(), []string{"policy", "test", "--scope", "deploy", "db-url"}, nil)
+	client.Exec(context.Background(), []string{"rename", "db-url", "db-url-old"}, nil)
+	if len(events) != 2 || events[0].Secret != "db-url" || events[1].Secret != "db-url" {
+		t.Errorf("expected unredacted names, got %+v", events)
+	}
+}
+
+func TestWithSlog_LogsInvocations(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"hunter2","version":1}`, "", 0)
+	var buf bytes.Buffer
+	cfg := &config{}
+	WithSlog(slog.New(slog.NewTextHandler(&buf, nil)))(cfg)
+	client.logger = cfg.logger
+
+	if _, err := client.Get(context.Background(), "db-url"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"level=INFO", `msg="authy invocation"`, "subcommand=get", "secret=db-url", "exit_code=0"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output missing %q: %s", want, out)
+		}
+	}
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("log output leaked the value: %s", out)
+	}
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordingSpan{name: name, attrs: map[string]any{}}
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return ctx, span
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *recordingSpan) RecordError(err error)              { s.err = err }
+func (s *recordingSpan) End()                               { s.ended = true }
+
+func TestWithTracer_SpansEachInvocation(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"v","version":1}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_STORE=",
+		`MOCK_STDERR_STORE={"error":{"code":"already_exists","message":"Secret already exists: db-url","exit_code":5}}`,
+		"MOCK_EXIT_STORE=5")
+	tracer := &recordingTracer{}
+	client.tracer = tracer
+	ctx := context.Background()
+
+	client.Get(ctx, "db-url", WithScope("deploy"))
+	client.Store(ctx, "db-url", "v")
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(tracer.spans))
+	}
+	get, store := tracer.spans[0], tracer.spans[1]
+	if get.name != "authy get" || !get.ended || get.err != nil {
+		t.Errorf("unexpected get span: %+v", get)
+	}
+	if get.attrs["authy.secret"] != "db-url" || get.attrs["authy.scope"] != "deploy" || get.attrs["authy.exit_code"] != 0 {
+		t.Errorf("unexpected get attributes: %v", get.attrs)
+	}
+	if store.name != "authy store" || !errors.Is(store.err, ErrSecretAlreadyExists) {
+		t.Errorf("unexpected store span: %+v", store)
+	}
+	if store.attrs["authy.error_code"] != "already_exists" || store.attrs["authy.exit_code"] != 5 {
+		t.Errorf("unexpected store attributes: %v", store.attrs)
+	}
+}
+
+type recordingMetrics struct {
+	mu    sync.Mutex
+	calls []string
+	hits  int
+}
+
+func (m *recordingMetrics) ObserveCall(op, code string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, op+":"+code)
+}
+
+func (m *recordingMetrics) CacheHit(op string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hits++
+}
+
+func TestWithMetrics_CountsCallsAndCacheHits(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"db-url","value":"v","version":1}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_LIST=",
+		`MOCK_STDERR_LIST={"error":{"code":"auth_failed","message":"Authentication failed","exit_code":2}}`,
+		"MOCK_EXIT_LIST=2")
+	metrics := &recordingMetrics{}
+	client.metrics = metrics
+	client.cache = newSecretCache(time.Minute, 0)
+	ctx := context.Background()
+
+	client.Get(ctx, "db-url")
+	client.Get(ctx, "db-url")
+	client.List(ctx)
+
+	if got := strings.Join(metrics.calls, ","); got != "get:ok,list:auth_failed" {
+		t.Errorf("unexpected calls: %s", got)
+	}
+	if metrics.hits != 1 {
+		t.Errorf("expected 1 cache hit, got %d", metrics.hits)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "authy 0.7.1\n", "", 0)
+	client.extraEnv = append(client.extraEnv, `MOCK_STDOUT_LIST={"secrets":[{"name":"a","version":1},{"name":"b","version":1}]}`)
+
+	st, err := client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !st.Ready() || st.SecretCount != 2 || st.CLIVersion != "0.7.1" {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_STDOUT_LIST=",
+		`MOCK_STDERR_LIST={"error":{"code":"auth_failed","message":"Authentication failed","exit_code":2}}`,
+		"MOCK_EXIT_LIST=2")
+	st, err = client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !st.Initialized || st.Unlocked || st.Ready() {
+		t.Errorf("expected initialized but locked, got %+v", st)
+	}
+
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDERR_LIST={"error":{"code":"vault_not_initialized","message":"Vault not initialized","exit_code":7}}`,
+		"MOCK_EXIT_LIST=7")
+	if st, err = client.Status(context.Background()); err != nil || st.Initialized {
+		t.Errorf("expected uninitialized status, got %+v, %v", st, err)
+	}
+}
+
+func TestErrInternalAndCodeOf(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "thread 'main' panicked", 1)
+
+	_, err := client.Get(context.Background(), "db-url")
+	if !errors.Is(err, ErrInternal) {
+		t.Errorf("expected ErrInternal, got %v", err)
+	}
+	if code := CodeOf(fmt.Errorf("wrapped: %w", err)); code != "internal_error" {
+		t.Errorf("unexpected code: %q", code)
+	}
+
+	client = newMockClient(t, bin, "", `{"error":{"code":"token_expired","message":"Token expired","exit_code":6}}`, 6)
+	_, err = client.Get(context.Background(), "db-url")
+	if CodeOf(err) != "token_expired" || errors.Is(err, ErrInternal) {
+		t.Errorf("unexpected error: %v (code %q)", err, CodeOf(err))
+	}
+	if CodeOf(errors.New("plain")) != "" {
+		t.Error("expected empty code for a non-CLI error")
+	}
+}
+
+func TestWatch_EmitsChangesAndDeletion(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"cfg","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}]}`,
+		"", 0)
+	recordArgs(t, client)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_3={"secrets":[{"name":"cfg","version":2,"created":"2025-01-01T00:00:00Z","modified":"2025-03-01T00:00:00Z"}]}`,
+		`MOCK_STDOUT_4={"secrets":[]}`,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := client.Watch(ctx, "cfg", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []WatchEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 events, got %+v", got)
+	}
+	if got[0].Version != 2 || got[0].Modified.Month() != time.March || got[0].Deleted {
+		t.Errorf("unexpected change event: %+v", got[0])
+	}
+	if !got[1].Deleted {
+		t.Errorf("expected terminal deleted event, got %+v", got[1])
+	}
+}
+
+func TestWatchMany_EmitsPerSecretEvents(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"db-url","version":1},{"name":"api-key","version":3},{"name":"other","version":1}]}`,
+		"", 0)
+	recordArgs(t, client)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_3={"secrets":[{"name":"db-url","version":2,"modified":"2025-03-01T00:00:00Z"},{"name":"api-key","version":3},{"name":"other","version":5}]}`,
+		`MOCK_STDOUT_4={"secrets":[{"name":"db-url","version":2},{"name":"other","version":5}]}`,
+		`MOCK_STDOUT_5={"secrets":[{"name":"other","version":5}]}`,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := client.WatchMany(ctx, []string{"db-url", "api-key"}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []ChangeEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	want := []ChangeEvent{
+		{Name: "db-url", Version: 2, Modified: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "api-key", Version: 3, Deleted: true},
+		{Name: "db-url", Version: 2, Deleted: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected events: %+v", got)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].Version != want[i].Version ||
+			got[i].Deleted != want[i].Deleted || !got[i].Modified.Equal(want[i].Modified) {
+			t.Errorf("event %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := client.WatchMany(ctx, []string{"missing"}, time.Second); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestOnRotate_CallsHooksWithNewValue(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[{"name":"db-url","version":1}]}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		`MOCK_STDOUT_2={"secrets":[{"name":"db-url","version":2}]}`,
+		`MOCK_STDOUT_3={"name":"db-url","value":"rotated","version":2}`,
+		`MOCK_STDOUT_4={"secrets":[]}`,
+	)
+	recordArgs(t, client)
+
+	var got []string
+	client.OnRotate("db-url", func(v string) { got = append(got, "a:"+v) })
+	client.OnRotate("db-url", func(v string) { got = append(got, "b:"+v) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.RunRotateHooks(ctx, 10*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(got, ",") != "a:rotated,b:rotated" {
+		t.Errorf("unexpected hook calls: %q", got)
+	}
+}
+
+func TestRunRotateHooks_NoHooks(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[]}`, "", 0)
+	args := recordArgs(t, client)
+
+	if err := client.RunRotateHooks(context.Background(), 10*time.Millisecond); err != nil {
+		t.Errorf("expected nil with no hooks, got %v", err)
+	}
+	if got := args(); len(got) != 0 {
+		t.Errorf("expected no CLI calls, got %q", got)
+	}
+}
+
+func TestWatch_ClosesOnCancel(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"cfg","version":1,"created":"2025-01-01T00:00:00Z","modified":"2025-01-01T00:00:00Z"}]}`,
+		"", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := client.Watch(ctx, "cfg", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected no events")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
+
+func TestPing(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"secrets":[]}`, "", 0)
+	args := recordArgs(t, client)
+	if err := client.Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json list" {
+		t.Errorf("unexpected args: %q", got)
+	}
+
+	client = newMockClient(t, bin, "",
+		`{"error":{"code":"auth_failed","message":"Authentication failed","exit_code":2}}`, 2)
+	if err := client.Ping(context.Background()); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestExec_ReturnsRawJSON(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"entries":[],"shown":0,"total":0}`, "", 0)
+	args := recordArgs(t, client)
+
+	raw, err := client.Exec(context.Background(), []string{"audit", "show"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(raw) != `{"entries":[],"shown":0,"total":0}` {
+		t.Errorf("unexpected output: %s", raw)
+	}
+	if got := args(); got[0] != "--json audit show" {
+		t.Errorf("unexpected args: %q", got[0])
+	}
+
+	client = newMockClient(t, bin, "",
+		`{"error":{"code":"access_denied","message":"Access denied","exit_code":4}}`, 4)
+	if _, err := client.Exec(context.Background(), []string{"policy", "list"}, nil); !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("expected ErrPolicyDenied, got %v", err)
+	}
+}
+
+func TestAudit_ParsesAndFilters(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"entries":[`+
+			`{"timestamp":"2025-01-01T10:00:00+00:00","operation":"store","secret":"db-url","actor":"master","outcome":"success","detail":"created"},`+
+			`{"timestamp":"2025-01-02T10:00:00+00:00","operation":"get","secret":"db-url","actor":"ci","outcome":"success"},`+
+			`{"timestamp":"2025-01-03T10:00:00+00:00","operation":"get","secret":"api-key","actor":"ci","outcome":"denied"}`+
+			`],"shown":3,"total":3}`,
+		"", 0)
+	args := recordArgs(t, client)
+
+	entries, err := client.Audit(context.Background(),
+		AuditSecret("db-url"), AuditSince(time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "get" || entries[0].Actor != "ci" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries[0].Timestamp.Day() != 2 {
+		t.Errorf("unexpected timestamp: %v", entries[0].Timestamp)
+	}
+	if got := args(); got[0] != "--json audit show --count 0" {
+		t.Errorf("unexpected args: %q", got[0])
+	}
+}
+
+func TestAudit_NoLog(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"entries":[],"shown":0,"total":0}`, "", 0)
+
+	if _, err := client.Audit(context.Background()); !errors.Is(err, ErrNoAuditLog) {
+		t.Errorf("expected ErrNoAuditLog, got %v", err)
+	}
+}
+
+func TestHistory_ReconstructsVersions(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"entries":[`+
+			`{"timestamp":"2025-01-01T10:00:00+00:00","operation":"store","secret":"db-url","actor":"master","outcome":"success"},`+
+			`{"timestamp":"2025-01-02T10:00:00+00:00","operation":"remove","secret":"db-url","actor":"master","outcome":"success"},`+
+			`{"timestamp":"2025-01-03T10:00:00+00:00","operation":"store","secret":"db-url","actor":"master","outcome":"success"},`+
+			`{"timestamp":"2025-01-04T10:00:00+00:00","operation":"get","secret":"db-url","actor":"ci","outcome":"success"},`+
+			`{"timestamp":"2025-01-05T10:00:00+00:00","operation":"rotate","secret":"db-url","actor":"ci","outcome":"success","detail":"version=2"},`+
+			`{"timestamp":"2025-01-06T10:00:00+00:00","operation":"import","secret":"db-url","actor":"master","outcome":"success","detail":"overwrite"},`+
+			`{"timestamp":"2025-01-07T10:00:00+00:00","operation":"rotate","secret":"api-key","actor":"ci","outcome":"success","detail":"version=9"}`+
+			`],"shown":7,"total":7}`,
+		"", 0)
+
+	versions, err := client.History(context.Background(), "db-url")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []struct {
+		version int
+		action  string
+		day     int
+	}{{1, "store", 3}, {2, "rotate", 5}, {3, "import", 6}}
+	if len(versions) != len(want) {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	for i, w := range want {
+		v := versions[i]
+		if v.Version != w.version || v.Action != w.action || v.Time.Day() != w.day {
+			t.Errorf("version %d: got %+v", i, v)
+		}
+	}
+	if versions[1].Actor != "ci" {
+		t.Errorf("unexpected actor: %q", versions[1].Actor)
+	}
+}
+
+func TestFakeStore_TracksVersions(t *testing.T) {
+	var store SecretStore = NewFakeStore()
+	ctx := context.Background()
+
+	if err := store.Store(ctx, "db-url", "v1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Store(ctx, "db-url", "v1"); !errors.Is(err, ErrSecretAlreadyExists) {
+		t.Errorf("expected ErrSecretAlreadyExists, got %v", err)
+	}
+	version, err := store.Rotate(ctx, "db-url", "v2")
+	if err != nil || version != 2 {
+		t.Fatalf("expected version 2, got %d (%v)", version, err)
+	}
+	if value, _ := store.Get(ctx, "db-url"); value != "v2" {
+		t.Errorf("expected 'v2', got %q", value)
+	}
+	if _, err := store.Remove(ctx, "db-url"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Get(ctx, "db-url"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+	if _, ok, err := store.GetOpt(ctx, "db-url"); ok || err != nil {
+		t.Errorf("expected missing secret, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestFakeStore_RunInjectsSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	store := NewFakeStore()
+	ctx := context.Background()
+	if err := store.Store(ctx, "db-url", "postgres://localhost/mydb"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := store.Run(ctx, []string{"sh", "-c", `printf %s "$APP_DB_URL"; exit 3`},
+		WithUppercase(), WithReplaceDash('_'), WithEnvPrefix("APP_"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 3 || string(result.Stdout) != "postgres://localhost/mydb" {
+		t.Errorf("unexpected result: exit %d, stdout %q", result.ExitCode, result.Stdout)
+	}
+}
+
+func TestWithMinVersion(t *testing.T) {
+	bin := buildMockBinary(t)
+	t.Setenv("MOCK_STDOUT", "authy 0.7.1\n")
+
+	client, err := New(WithBinary(bin), WithMinVersion("0.7.0"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Version() != "0.7.1" {
+		t.Errorf("expected version 0.7.1, got %q", client.Version())
+	}
+	if _, err := New(WithBinary(bin), WithMinVersion("0.8")); !errors.Is(err, ErrIncompatibleCLI) {
+		t.Errorf("expected ErrIncompatibleCLI for CLI older than minimum, got %v", err)
+	}
+	if v, err := client.CLIVersion(context.Background()); err != nil || v != "0.7.1" {
+		t.Errorf("CLIVersion: got %q, %v", v, err)
+	}
+	t.Setenv("MOCK_STDOUT", "garbage\n")
+	if _, err := client.CLIVersion(context.Background()); err == nil {
+		t.Error("expected error for unrecognized version output")
+	}
+}
+
+func TestWithMinVersion_UnknownVersionWarns(t *testing.T) {
+	bin := buildMockBinary(t)
+	t.Setenv("MOCK_STDOUT", "")
+
+	var warnings []string
+	client, err := New(WithBinary(bin), WithMinVersion("0.7.0"), WithLogger(func(ctx context.Context, event Event) {
+		warnings = append(warnings, event.Warning)
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.Version() != "" {
+		t.Errorf("expected unknown version, got %q", client.Version())
+	}
+	if len(warnings) != 1 || warnings[0] == "" {
+		t.Errorf("expected one warning, got %q", warnings)
+	}
+}
+
+func TestIsInitialized_FollowsHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if IsInitialized() {
+		t.Fatal("expected no vault in empty home")
+	}
+
+	vault := filepath.Join(home, ".authy", "vault.age")
+	if err := os.MkdirAll(filepath.Dir(vault), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(vault, []byte("age"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !IsInitialized() {
+		t.Error("expected vault to be found under HOME")
+	}
+	if !IsInitializedAt(vault) {
+		t.Error("expected IsInitializedAt to find explicit path")
+	}
+	if IsInitializedAt(filepath.Join(home, "missing.age")) {
+		t.Error("expected IsInitializedAt to report missing path")
+	}
+}
+
+func TestNew_DefaultLooksOnPath(t *testing.T) {
+	// This test just ensures that New() without WithBinary tries LookPath.
+	// It may fail in environments without authy on PATH, which is expected.
+	_, err := New()
+	if err != nil {
 		// Expected — authy is likely not on PATH in the test environment.
 		return
 	}
 	// If it succeeded, that's fine too.
 }
 
+func TestSessionMultiplexesOperations(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_TOOL_GET_SECRET=s3cret",
+		`MOCK_TOOL_LIST_SECRETS=["a","b"]`,
+		"MOCK_TOOL_REMOVE_SECRET=Secret 'x' not found",
+		"MOCK_TOOL_STORE_SECRET=Secret already exists: x (use --force to overwrite)",
+		"MOCK_TOOLERR_STORE_SECRET=1",
+	)
+
+	ctx := context.Background()
+	sess, err := client.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		v, err := sess.Get(ctx, "x")
+		if err != nil || v != "s3cret" {
+			t.Fatalf("Get = %q, %v", v, err)
+		}
+	}
+	names, err := sess.List(ctx)
+	if err != nil || strings.Join(names, ",") != "a,b" {
+		t.Fatalf("List = %v, %v", names, err)
+	}
+	if existed, err := sess.Remove(ctx, "x"); err != nil || existed {
+		t.Fatalf("Remove = %v, %v", existed, err)
+	}
+	if err := sess.Store(ctx, "x", "v"); !errors.Is(err, ErrSecretAlreadyExists) {
+		t.Fatalf("Store error = %v, want ErrSecretAlreadyExists", err)
+	}
+	if err := sess.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := sess.Get(ctx, "x"); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("Get after Close = %v, want ErrSessionClosed", err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json serve --mcp" {
+		t.Errorf("invocations = %q, want a single serve", got)
+	}
+}
+
+func TestSession_TakesNoProcessSlot(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, `{"name":"x","value":"v","version":1}`, "", 0)
+	client.procs = make(chan struct{}, 1)
+	client.extraEnv = append(client.extraEnv, "MOCK_TOOL_GET_SECRET=s3cret")
+
+	sess, err := client.StartSession(context.Background())
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	defer sess.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if v, err := client.Get(ctx, "x"); err != nil || v != "v" {
+		t.Errorf("expected Get to run beside the session, got %q, %v", v, err)
+	}
+}
+
+func TestSession_WritesShareTheWriteLock(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	client.extraEnv = append(client.extraEnv, "MOCK_TOOL_STORE_SECRET=Stored secret 'x'")
+
+	sess, err := client.StartSession(context.Background())
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	defer sess.Close()
+
+	unlock, err := client.lockWrite(context.Background())
+	if err != nil {
+		t.Fatalf("lockWrite: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := sess.Store(ctx, "x", "v"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Store to wait for the held write lock, got %v", err)
+	}
+	unlock()
+	if err := sess.Store(context.Background(), "x", "v"); err != nil {
+		t.Errorf("unexpected error after unlock: %v", err)
+	}
+}
+
+func TestSession_CloseAfterOversizedResponse(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	// The response overruns the line limit by far more than a pipe buffer,
+	// so the process blocks writing it once the session stops reading.
+	client.extraEnv = append(client.extraEnv,
+		"MOCK_TOOL_GET_SECRET=0123456789abcdef",
+		fmt.Sprintf("MOCK_TOOLREPEAT_GET_SECRET=%d", 2*maxSessionLine/16))
+
+	sess, err := client.StartSession(context.Background())
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	if _, err := sess.Get(context.Background(), "x"); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed for an oversized response, got %v", err)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- sess.Close() }()
+	select {
+	case err := <-closed:
+		if !errors.Is(err, bufio.ErrTooLong) {
+			t.Errorf("expected Close to report the oversized line, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close hung waiting for the session process")
+	}
+}
+
+func TestSyncTo(t *testing.T) {
+	bin := buildMockBinary(t)
+	source := newMockClient(t, bin, "", "", 0)
+	source.extraEnv = append(source.extraEnv,
+		`MOCK_STDOUT_LIST={"secrets":[{"name":"db-url","version":2},{"name":"api-key","version":1},{"name":"local-only","version":1},{"name":"cache-url","version":1}]}`,
+		`MOCK_STDOUT_2={"name":"api-key","value":"key-1","version":1}`,
+		`MOCK_STDOUT_3={"name":"cache-url","value":"redis://same","version":1}`,
+		`MOCK_STDOUT_4={"name":"db-url","value":"postgres://new","version":2}`,
+	)
+	recordArgs(t, source)
+
+	target := newMockClient(t, bin, "", "", 0)
+	target.extraEnv = append(target.extraEnv,
+		`MOCK_STDOUT_LIST={"secrets":[{"name":"db-url","version":1},{"name":"cache-url","version":1}]}`,
+		`MOCK_STDOUT_3={"name":"cache-url","value":"redis://same","version":1}`,
+		`MOCK_STDOUT_4={"name":"db-url","value":"postgres://old","version":1}`,
+		"MOCK_STDERR_ROTATE=Secret 'db-url' rotated to version 2.\n",
+	)
+	targetArgs := recordArgs(t, target)
+	ctx := context.Background()
+
+	report, err := source.SyncTo(ctx, target, SyncExclude("local-*"), SyncConflict(ConflictOverwrite))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fmt.Sprint(report.Created, report.Updated, report.Unchanged, report.Skipped)
+	if want := "[api-key] [db-url] [cache-url] []"; got != want {
+		t.Errorf("unexpected report: %s", got)
+	}
+	want := []string{"--json list", "--json store api-key", "--json get cache-url", "--json get db-url", "--json rotate db-url"}
+	if got := targetArgs(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected target calls: %q", got)
+	}
+
+	if _, err := source.SyncTo(ctx, target, SyncConflict(ConflictFail)); !errors.Is(err, ErrSecretAlreadyExists) {
+		t.Errorf("expected ErrSecretAlreadyExists, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	bin := buildMockBinary(t)
+	staging := newMockClient(t, bin, "", "", 0)
+	staging.extraEnv = append(staging.extraEnv,
+		`MOCK_STDOUT_LIST={"secrets":[{"name":"api-key","version":2},{"name":"db-url","version":3},{"name":"debug-token","version":1}]}`,
+		`MOCK_STDOUT_GET={"name":"x","value":"same","version":1}`,
+	)
+	prod := newMockClient(t, bin, "", "", 0)
+	prod.extraEnv = append(prod.extraEnv,
+		`MOCK_STDOUT_LIST={"secrets":[{"name":"api-key","version":2},{"name":"db-url","version":1},{"name":"smtp-pass","version":1}]}`,
+		`MOCK_STDOUT_GET={"name":"x","value":"same","version":1}`,
+	)
+	ctx := context.Background()
+
+	report, err := staging.Diff(ctx, prod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := fmt.Sprint(report.Added, report.Removed, report.Changed, report.Unchanged)
+	if want := "[smtp-pass] [debug-token] [{db-url 3 1 false}] [api-key]"; got != want {
+		t.Errorf("unexpected report: %s", got)
+	}
+	if report.InSync() {
+		t.Error("expected InSync to be false")
+	}
+
+	report, err = staging.Diff(ctx, prod, CompareValues())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Changed) != 0 || strings.Join(report.Unchanged, ",") != "api-key,db-url" {
+		t.Errorf("expected equal values to match despite versions: %+v", report)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	bin := buildMockBinary(t)
+	audit := func(actor string) string {
+		return `MOCK_STDOUT_AUDIT={"entries":[` +
+			`{"timestamp":"2099-01-01T00:00:00Z","operation":"list","actor":"other","outcome":"failure"},` +
+			`{"timestamp":"2099-01-01T00:00:00Z","operation":"list","actor":"` + actor + `","outcome":"success"}],"total":2}`
+	}
+	ctx := context.Background()
+
+	client := newMockClient(t, bin, `{"secrets":[]}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		audit("token(s-42)"),
+		`MOCK_STDOUT_SESSION={"sessions":[{"id":"s-1","scope":"admin","run_only":false,"created":"2025-01-01T00:00:00Z","expires":"2025-01-02T00:00:00Z"},`+
+			`{"id":"s-42","scope":"deploy","run_only":true,"label":"ci","created":"2025-01-01T00:00:00Z","expires":"2025-01-01T01:00:00.5+00:00"}]}`,
+	)
+	id, err := client.WhoAmI(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id.Method != AuthToken || id.SessionID != "s-42" || id.Label != "ci" || !id.RunOnly || id.Master() {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+	if !id.HasScope("deploy") || id.HasScope("admin") {
+		t.Errorf("unexpected scopes: %v", id.Scopes)
+	}
+	if want := time.Date(2025, 1, 1, 1, 0, 0, 5e8, time.UTC); !id.Expires.Equal(want) {
+		t.Errorf("unexpected expiry: %v", id.Expires)
+	}
+
+	client = newMockClient(t, bin, `{"secrets":[]}`, "", 0)
+	client.extraEnv = append(client.extraEnv,
+		audit("master(keyfile)"),
+		`MOCK_STDOUT_POLICY={"policies":[{"name":"deploy","allow_count":1,"deny_count":0}]}`,
+	)
+	if id, err = client.WhoAmI(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id.Method != AuthKeyfile || !id.Master() || !id.HasScope("deploy") {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+}
+
+func TestImport_DotenvHonorsForce(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin, "", "", 0)
+	args := recordArgs(t, client)
+	stdin := recordStdin(t, client)
+
+	if err := client.Import(context.Background(), strings.NewReader("DB_URL=postgres://x\n"), FormatDotenv, Force()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := args(); len(got) != 1 || got[0] != "--json import - --force" {
+		t.Errorf("unexpected args: %q", got)
+	}
+	if got := stdin(); got != "DB_URL=postgres://x\n" {
+		t.Errorf("unexpected stdin: %q", got)
+	}
+}
+
+func TestExists_RetriesAndObservesStreamedList(t *testing.T) {
+	bin := buildMockBinary(t)
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":"db-url","version":1}]}`,
+		`{"error":{"code":"io_error","message":"IO error: No such file or directory (os error 2)","exit_code":1}}`,
+		1)
+	client.extraEnv = append(client.extraEnv, "MOCK_STDOUT_1=", "MOCK_EXIT_2=0", "MOCK_STDERR_2=")
+	client.retry = retryPolicy{attempts: 3, backoff: time.Millisecond}
+	metrics := &recordingMetrics{}
+	client.metrics = metrics
+	calls := recordArgs(t, client)
+
+	found, err := client.Exists(context.Background(), "db-url")
+	if err != nil || !found {
+		t.Fatalf("expected retry to find the secret, got %v, %v", found, err)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(got))
+	}
+	if got := strings.Join(metrics.calls, ","); got != "list:io_error,list:ok" {
+		t.Errorf("unexpected observed calls: %s", got)
+	}
+}
+
+func TestListStream_DecodeErrorDoesNotHang(t *testing.T) {
+	bin := buildMockBinary(t)
+	// More output than a pipe buffers follows the malformed entry, so the
+	// child blocks writing until it is killed.
+	client := newMockClient(t, bin,
+		`{"secrets":[{"name":1},`+strings.Repeat(" ", 100<<10)+`]}`, "", 0)
+	metrics := &recordingMetrics{}
+	client.metrics = metrics
+
+	done := make(chan error, 1)
+	go func() { done <- client.ListStream(context.Background(), func(ListResult) error { return nil }) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected a decoding error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ListStream hung after a decoding error")
+	}
+	if got := strings.Join(metrics.calls, ","); got != "list:client_error" {
+		t.Errorf("unexpected observed calls: %s", got)
+	}
+}
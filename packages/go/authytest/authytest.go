@@ -0,0 +1,108 @@
+// Package authytest provides an in-memory authy.SecretStore for tests, so
+// code built on the authy client can be exercised without an authy binary.
+package authytest
+
+import (
+	"context"
+	"sync"
+
+	authy "github.com/eric8810/authy/packages/go"
+)
+
+var _ authy.SecretStore = (*Fake)(nil)
+
+// Fake is an in-memory authy.SecretStore. It tracks versions and scope
+// policies like authy.FakeStore, and can be told to fail upcoming calls
+// with FailNextWith. It is safe for concurrent use.
+type Fake struct {
+	*authy.FakeStore
+
+	mu       sync.Mutex
+	failures []error
+}
+
+// NewFake creates an empty Fake.
+func NewFake() *Fake {
+	return &Fake{FakeStore: authy.NewFakeStore()}
+}
+
+// FailNextWith makes the next operation return err without touching the
+// store, e.g. FailNextWith(authy.ErrAuthFailed). Repeated calls queue
+// failures for the operations that follow, in order.
+func (f *Fake) FailNextWith(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, err)
+}
+
+// injected pops the next queued failure, if any.
+func (f *Fake) injected() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.failures) == 0 {
+		return nil
+	}
+	err := f.failures[0]
+	f.failures = f.failures[1:]
+	return err
+}
+
+// Get returns the value of a secret, or a queued failure.
+func (f *Fake) Get(ctx context.Context, name string, opts ...authy.CallOption) (string, error) {
+	if err := f.injected(); err != nil {
+		return "", err
+	}
+	return f.FakeStore.Get(ctx, name, opts...)
+}
+
+// GetOpt returns the value of a secret and whether it exists, or a queued
+// failure.
+func (f *Fake) GetOpt(ctx context.Context, name string, opts ...authy.CallOption) (string, bool, error) {
+	if err := f.injected(); err != nil {
+		return "", false, err
+	}
+	return f.FakeStore.GetOpt(ctx, name, opts...)
+}
+
+// Store creates or, with authy.Force, replaces a secret, or returns a
+// queued failure.
+func (f *Fake) Store(ctx context.Context, name, value string, opts ...authy.CallOption) error {
+	if err := f.injected(); err != nil {
+		return err
+	}
+	return f.FakeStore.Store(ctx, name, value, opts...)
+}
+
+// Remove deletes a secret, or returns a queued failure.
+func (f *Fake) Remove(ctx context.Context, name string, opts ...authy.CallOption) (bool, error) {
+	if err := f.injected(); err != nil {
+		return false, err
+	}
+	return f.FakeStore.Remove(ctx, name, opts...)
+}
+
+// Rotate replaces a secret's value and returns its new version, or a
+// queued failure.
+func (f *Fake) Rotate(ctx context.Context, name, newValue string, opts ...authy.CallOption) (int, error) {
+	if err := f.injected(); err != nil {
+		return 0, err
+	}
+	return f.FakeStore.Rotate(ctx, name, newValue, opts...)
+}
+
+// List returns the names of the secrets, or a queued failure.
+func (f *Fake) List(ctx context.Context, opts ...authy.CallOption) ([]string, error) {
+	if err := f.injected(); err != nil {
+		return nil, err
+	}
+	return f.FakeStore.List(ctx, opts...)
+}
+
+// Run executes command with the secrets injected, or returns a queued
+// failure without running it.
+func (f *Fake) Run(ctx context.Context, command []string, opts ...authy.CallOption) (*authy.RunResult, error) {
+	if err := f.injected(); err != nil {
+		return nil, err
+	}
+	return f.FakeStore.Run(ctx, command, opts...)
+}
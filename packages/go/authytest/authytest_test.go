@@ -0,0 +1,48 @@
+package authytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	authy "github.com/eric8810/authy/packages/go"
+)
+
+func TestFake_FailNextWith(t *testing.T) {
+	fake := NewFake()
+	ctx := context.Background()
+	if err := fake.Store(ctx, "db-url", "v1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake.FailNextWith(authy.ErrAuthFailed)
+	if _, err := fake.Get(ctx, "db-url"); !errors.Is(err, authy.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed, got %v", err)
+	}
+	if value, err := fake.Get(ctx, "db-url"); err != nil || value != "v1" {
+		t.Errorf("expected failure to apply once, got %q (%v)", value, err)
+	}
+}
+
+func TestFake_Scopes(t *testing.T) {
+	fake := NewFake()
+	ctx := context.Background()
+	for _, name := range []string{"db-url", "db-password", "api-key"} {
+		if err := fake.Store(ctx, name, "x"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	fake.AddPolicy("deploy", []string{"db-*"}, []string{"db-password"})
+
+	names, err := fake.List(ctx, authy.WithScope("deploy"))
+	if err != nil || len(names) != 1 || names[0] != "db-url" {
+		t.Errorf("expected [db-url], got %v (%v)", names, err)
+	}
+	if _, err := fake.Get(ctx, "api-key", authy.WithScope("deploy")); !errors.Is(err, authy.ErrPolicyDenied) {
+		t.Errorf("expected ErrPolicyDenied, got %v", err)
+	}
+	var authyErr *authy.AuthyError
+	if _, err := fake.Get(ctx, "db-url", authy.WithScope("missing")); !errors.As(err, &authyErr) || authyErr.Message != "Policy not found: missing" {
+		t.Errorf("expected policy not found, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package authy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// WithConcurrency sets how many subprocesses a batch operation such as
+// BatchGet runs at once. The default is runtime.GOMAXPROCS(0).
+func WithConcurrency(n int) CallOption {
+	return func(c *callConfig) {
+		c.concurrency = n
+	}
+}
+
+// BatchGet retrieves several secrets, running Get for each name across a
+// bounded pool of workers. The remaining options are passed to each Get.
+//
+// On partial failure it returns the secrets that were fetched together with
+// an error joining one error per failed name (see errors.Join); each wraps
+// the underlying error, so errors.Is still matches sentinels.
+func (c *Client) BatchGet(ctx context.Context, names []string, opts ...CallOption) (map[string]string, error) {
+	values, failed := c.batchGet(ctx, names, opts)
+	errs := make([]error, 0, len(failed))
+	for _, name := range names {
+		if err, ok := failed[name]; ok {
+			errs = append(errs, fmt.Errorf("authy: get %q: %w", name, err))
+			delete(failed, name)
+		}
+	}
+	return values, errors.Join(errs...)
+}
+
+// GetMany retrieves several secrets concurrently. It is the same as
+// BatchGet: the CLI has no batch mode, so one Get runs per name across a
+// pool bounded by WithConcurrency.
+func (c *Client) GetMany(ctx context.Context, names []string, opts ...CallOption) (map[string]string, error) {
+	return c.BatchGet(ctx, names, opts...)
+}
+
+// batchGet runs Get for each name across a bounded pool of workers and
+// returns the values fetched and the error for each name that failed.
+func (c *Client) batchGet(ctx context.Context, names []string, opts []CallOption) (map[string]string, map[string]error) {
+	cfg := c.newCallConfig(opts)
+	workers := cfg.concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	values := make([]string, len(names))
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			values[i], errs[i] = c.Get(ctx, name, opts...)
+		}(i, name)
+	}
+	wg.Wait()
+
+	result := make(map[string]string, len(names))
+	failed := make(map[string]error)
+	for i, name := range names {
+		if errs[i] != nil {
+			failed[name] = errs[i]
+		} else {
+			result[name] = values[i]
+		}
+	}
+	return result, failed
+}
+
+// StoreAll stores every entry in secrets, passing the remaining options
+// (such as Force) to each Store. Entries are written one at a time in sorted
+// name order, since the CLI rewrites the whole vault on each store, and each
+// value goes to its own process via stdin.
+//
+// A failed entry does not stop the rest; the returned error joins one error
+// per failed name, as with BatchGet. If ctx is cancelled, remaining entries
+// are not attempted.
+func (c *Client) StoreAll(ctx context.Context, secrets map[string]string, opts ...CallOption) error {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := c.Store(ctx, name, secrets[name], opts...); err != nil {
+			errs = append(errs, fmt.Errorf("authy: store %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveMany deletes each of names, one at a time in the order given, and
+// returns the names that were removed. Names that do not exist are skipped
+// rather than reported as errors, so cleanup can be repeated safely. With
+// DryRun, nothing is removed and the names that exist are returned instead.
+//
+// A failed removal does not stop the rest; the returned error joins one
+// error per failed name, as with StoreAll. If ctx is cancelled, remaining
+// names are not attempted.
+func (c *Client) RemoveMany(ctx context.Context, names []string, opts ...CallOption) ([]string, error) {
+	cfg := c.newCallConfig(opts)
+	if cfg.dryRun {
+		existing, err := c.List(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]bool, len(existing))
+		for _, name := range existing {
+			found[name] = true
+		}
+		matched := []string{}
+		for _, name := range names {
+			if found[name] {
+				matched = append(matched, name)
+				delete(found, name)
+			}
+		}
+		return matched, nil
+	}
+
+	removed := []string{}
+	var errs []error
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if _, err := c.Remove(ctx, name, opts...); err != nil {
+			if !errors.Is(err, ErrSecretNotFound) {
+				errs = append(errs, fmt.Errorf("authy: remove %q: %w", name, err))
+			}
+			continue
+		}
+		removed = append(removed, name)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// RemoveByPrefix deletes every secret whose name starts with prefix, such as
+// the per-branch secrets a CI run created, and returns how many were
+// removed. With DryRun, it returns how many would be removed; List with
+// WithPrefix gives their names. An empty prefix is rejected rather than
+// emptying the vault.
+func (c *Client) RemoveByPrefix(ctx context.Context, prefix string, opts ...CallOption) (int, error) {
+	if prefix == "" {
+		return 0, fmt.Errorf("authy: RemoveByPrefix requires a non-empty prefix")
+	}
+	names, err := c.List(ctx, append(opts[:len(opts):len(opts)], WithPrefix(prefix))...)
+	if err != nil {
+		return 0, err
+	}
+	if c.newCallConfig(opts).dryRun {
+		return len(names), nil
+	}
+	removed, err := c.RemoveMany(ctx, names, opts...)
+	return len(removed), err
+}
@@ -0,0 +1,138 @@
+package authy
+
+import (
+	"sync"
+	"time"
+)
+
+// secretCache memoizes successful Get results for a bounded time. It is safe
+// for concurrent use.
+type secretCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[cacheKey]cacheEntry
+	// generation is bumped on every invalidation so that a Get racing with
+	// a write does not repopulate the cache with the value it read before.
+	generation uint64
+}
+
+type cacheKey struct {
+	// vault is the per-call WithVaultScope override, or "" for the client's
+	// own vault.
+	vault   string
+	name    string
+	scope   string
+	version int
+}
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+// WithCache enables a read-through cache for Get. Successful results are
+// kept for ttl, keyed by vault, name, scope, and version, with at most
+// maxEntries held at once; 0 means unbounded, so WithCache(ttl, 0) is a
+// plain TTL cache. Store, Rotate, Remove, and Rename drop cached entries for the
+// names they touch, and imports drop them all; use InvalidateCache for
+// changes made outside this client. Missing secrets are never cached.
+func WithCache(ttl time.Duration, maxEntries int) Option {
+	return func(c *config) {
+		c.cacheTTL = ttl
+		c.cacheMax = maxEntries
+	}
+}
+
+// InvalidateCache drops all cached values for name. It is a no-op when the
+// cache is disabled.
+func (c *Client) InvalidateCache(name string) {
+	if c.cache != nil {
+		c.cache.invalidate(name)
+	}
+}
+
+// clearCache drops every cached value, for writes such as imports that may
+// touch any secret.
+func (c *Client) clearCache() {
+	if c.cache != nil {
+		c.cache.clear()
+	}
+}
+
+func newSecretCache(ttl time.Duration, maxEntries int) *secretCache {
+	return &secretCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[cacheKey]cacheEntry),
+	}
+}
+
+// get returns the cached value for key if it has not expired, along with
+// the current generation to pass to put after a miss.
+func (sc *secretCache) get(key cacheKey) (string, uint64, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	entry, ok := sc.entries[key]
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, sc.generation, true
+	}
+	if ok {
+		delete(sc.entries, key)
+	}
+	return "", sc.generation, false
+}
+
+// put stores value under key unless an invalidation happened since gen was
+// observed.
+func (sc *secretCache) put(key cacheKey, value string, gen uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if gen != sc.generation {
+		return
+	}
+	now := time.Now()
+	if _, ok := sc.entries[key]; !ok && sc.maxEntries > 0 && len(sc.entries) >= sc.maxEntries {
+		sc.evict(now)
+	}
+	sc.entries[key] = cacheEntry{value: value, expires: now.Add(sc.ttl)}
+}
+
+// evict removes expired entries, or the entry closest to expiry if none
+// have expired. The caller must hold mu.
+func (sc *secretCache) evict(now time.Time) {
+	var oldest cacheKey
+	var oldestExpires time.Time
+	for key, entry := range sc.entries {
+		if !now.Before(entry.expires) {
+			delete(sc.entries, key)
+			continue
+		}
+		if oldestExpires.IsZero() || entry.expires.Before(oldestExpires) {
+			oldest, oldestExpires = key, entry.expires
+		}
+	}
+	if len(sc.entries) >= sc.maxEntries {
+		delete(sc.entries, oldest)
+	}
+}
+
+// invalidate drops every entry for name.
+func (sc *secretCache) invalidate(name string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.generation++
+	for key := range sc.entries {
+		if key.name == name {
+			delete(sc.entries, key)
+		}
+	}
+}
+
+// clear drops every entry.
+func (sc *secretCache) clear() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.generation++
+	clear(sc.entries)
+}
@@ -0,0 +1,107 @@
+package authy
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+)
+
+// DiffReport compares the secrets of two clients by name. Each list is
+// sorted by name. It never holds secret values.
+type DiffReport struct {
+	// Added holds secrets present only in the other client.
+	Added []string
+	// Removed holds secrets present only in this client.
+	Removed []string
+	// Changed holds secrets present in both that differ.
+	Changed []DiffChange
+	// Unchanged holds secrets present in both that match.
+	Unchanged []string
+}
+
+// InSync reports whether the two sides hold the same secrets.
+func (r *DiffReport) InSync() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0
+}
+
+// DiffChange is a secret that differs between the two clients.
+type DiffChange struct {
+	Name         string
+	Version      int
+	OtherVersion int
+	// ValueDiffers is set when CompareValues found different values. Without
+	// CompareValues, secrets are compared by version only.
+	ValueDiffers bool
+}
+
+// Diff compares the secrets visible to c with those visible to other, such
+// as a staging and a production vault, to check parity before a release.
+// The options (WithScope, WithPrefix, WithGlob, WithTag) filter both
+// listings.
+//
+// By default secrets are compared by version, from metadata alone. With
+// CompareValues, secrets present on both sides are fetched and compared by
+// digest instead, and a secret counts as changed only if its value differs;
+// versions are still reported, since independently managed vaults number
+// them differently.
+func (c *Client) Diff(ctx context.Context, other *Client, opts ...CallOption) (*DiffReport, error) {
+	cfg := c.newCallConfig(opts)
+	mine, err := c.ListDetailed(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := other.ListDetailed(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]int, len(theirs))
+	for _, e := range theirs {
+		versions[e.Name] = e.Version
+	}
+
+	report := &DiffReport{Added: []string{}, Removed: []string{}, Changed: []DiffChange{}, Unchanged: []string{}}
+	for _, e := range mine {
+		otherVersion, ok := versions[e.Name]
+		if !ok {
+			report.Removed = append(report.Removed, e.Name)
+			continue
+		}
+		delete(versions, e.Name)
+		change := DiffChange{Name: e.Name, Version: e.Version, OtherVersion: otherVersion}
+		differs := e.Version != otherVersion
+		if cfg.compareValues {
+			if change.ValueDiffers, err = c.valuesDiffer(ctx, other, e.Name, opts); err != nil {
+				return nil, err
+			}
+			differs = change.ValueDiffers
+		}
+		if differs {
+			report.Changed = append(report.Changed, change)
+		} else {
+			report.Unchanged = append(report.Unchanged, e.Name)
+		}
+	}
+	for name := range versions {
+		report.Added = append(report.Added, name)
+	}
+
+	sort.Strings(report.Added)
+	sort.Strings(report.Removed)
+	sort.Strings(report.Unchanged)
+	sort.Slice(report.Changed, func(i, j int) bool { return report.Changed[i].Name < report.Changed[j].Name })
+	return report, nil
+}
+
+// valuesDiffer fetches name from both clients and compares the digests of
+// the values.
+func (c *Client) valuesDiffer(ctx context.Context, other *Client, name string, opts []CallOption) (bool, error) {
+	mine, err := c.Get(ctx, name, opts...)
+	if err != nil {
+		return false, err
+	}
+	theirs, err := other.Get(ctx, name, opts...)
+	if err != nil {
+		return false, err
+	}
+	return sha256.Sum256([]byte(mine)) != sha256.Sum256([]byte(theirs)), nil
+}
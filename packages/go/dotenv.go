@@ -0,0 +1,118 @@
+package authy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DotenvQuoting selects how ExportDotenv and ExportDotenvFile quote values.
+type DotenvQuoting int
+
+const (
+	// QuoteAsNeeded double-quotes only values containing whitespace, quotes,
+	// backslashes, '#', '$', or '`', exactly as `authy export` does.
+	QuoteAsNeeded DotenvQuoting = iota
+	// QuoteAlways double-quotes every value, for parsers that treat
+	// unquoted values differently.
+	QuoteAlways
+)
+
+// WithQuoting sets how ExportDotenv and ExportDotenvFile quote values. The
+// default is QuoteAsNeeded.
+func WithQuoting(q DotenvQuoting) CallOption {
+	return func(c *callConfig) {
+		c.quoting = q
+	}
+}
+
+// ExportDotenvFile writes secrets to the file at path in dotenv format, as
+// ExportDotenv does. The file is created with mode 0600 and replaced
+// atomically, so readers never see a partial file.
+func (c *Client) ExportDotenvFile(ctx context.Context, path string, opts ...CallOption) error {
+	var buf bytes.Buffer
+	defer func() { wipe(buf.Bytes()) }()
+	if err := c.ExportDotenv(ctx, &buf, opts...); err != nil {
+		return err
+	}
+
+	return writePrivateFile(path, buf.Bytes(), "dotenv file")
+}
+
+// writePrivateFile atomically replaces the file at path with data, with
+// mode 0600. kind names the file in error messages.
+func writePrivateFile(path string, data []byte, kind string) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("authy: creating %s: %w", kind, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err := tmp.Chmod(0o600); err != nil {
+		return fmt.Errorf("authy: creating %s: %w", kind, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("authy: writing %s: %w", kind, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("authy: writing %s: %w", kind, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("authy: writing %s: %w", kind, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("authy: writing %s: %w", kind, err)
+	}
+	return nil
+}
+
+// formatDotenv renders vars as sorted KEY=value lines.
+func formatDotenv(vars map[string]string, q DotenvQuoting) []byte {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		writeDotenvValue(&buf, vars[k], q)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// writeDotenvValue writes value quoted and escaped like the CLI's
+// dotenv_quote.
+func writeDotenvValue(buf *bytes.Buffer, value string, q DotenvQuoting) {
+	if q == QuoteAsNeeded && value != "" && !strings.ContainsAny(value, " #\"'\\\n\r\t$`") {
+		buf.WriteString(value)
+		return
+	}
+	buf.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch ch := value[i]; ch {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(ch)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	buf.WriteByte('"')
+}
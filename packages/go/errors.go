@@ -1,9 +1,11 @@
 package authy
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // AuthyError represents an error returned by the authy CLI.
@@ -11,6 +13,17 @@ type AuthyError struct {
 	ExitCode int
 	Code     string
 	Message  string
+	// Raw holds the CLI's stderr output as received, for debugging codes
+	// this package does not recognize. It is not included in Error.
+	Raw []byte
+	// Args holds the subcommand and arguments of the failed invocation,
+	// without the global flags, e.g. ["get", "db-url"]. Secret values are
+	// always passed on stdin and never appear here; secret names are
+	// replaced with "[REDACTED]" when WithRedactNames is set.
+	Args []string
+	// Err is the underlying process error, such as an *exec.ExitError,
+	// when the error came from running the CLI.
+	Err error
 }
 
 func (e *AuthyError) Error() string {
@@ -20,6 +33,24 @@ func (e *AuthyError) Error() string {
 	return fmt.Sprintf("authy: %s (exit code %d)", e.Code, e.ExitCode)
 }
 
+// Detail returns the error message followed by the command that failed and
+// the raw stderr output, if known.
+func (e *AuthyError) Detail() string {
+	detail := e.Error()
+	if len(e.Args) > 0 {
+		detail += fmt.Sprintf(" (command: authy %s)", strings.Join(e.Args, " "))
+	}
+	if len(e.Raw) > 0 {
+		detail += fmt.Sprintf(" (stderr: %s)", bytes.TrimSpace(e.Raw))
+	}
+	return detail
+}
+
+// Unwrap returns the underlying process error, if any.
+func (e *AuthyError) Unwrap() error {
+	return e.Err
+}
+
 // Is supports errors.Is matching by comparing the Code field.
 func (e *AuthyError) Is(target error) bool {
 	var t *AuthyError
@@ -32,12 +63,67 @@ func (e *AuthyError) Is(target error) bool {
 // Sentinel errors matching authy CLI exit codes and error codes.
 var (
 	ErrSecretNotFound      = &AuthyError{ExitCode: 3, Code: "not_found"}
+	ErrVersionNotFound     = &AuthyError{ExitCode: 3, Code: "version_not_found"}
 	ErrSecretAlreadyExists = &AuthyError{ExitCode: 5, Code: "already_exists"}
 	ErrAuthFailed          = &AuthyError{ExitCode: 2, Code: "auth_failed"}
 	ErrPolicyDenied        = &AuthyError{ExitCode: 4, Code: "access_denied"}
+	ErrInvalidToken        = &AuthyError{ExitCode: 6, Code: "invalid_token"}
 	ErrVaultNotFound       = &AuthyError{ExitCode: 7, Code: "vault_not_initialized"}
+
+	// ErrInternal matches a failure with exit code 1 that carried no JSON
+	// error, such as a crash. Failures the CLI reports itself have a more
+	// specific code, such as "io_error" or "error".
+	ErrInternal = &AuthyError{ExitCode: 1, Code: "internal_error"}
 )
 
+// CodeOf returns the error code of the first *AuthyError in err's chain,
+// such as "not_found" or "token_expired", or "" if there is none. It is
+// for codes that have no sentinel error.
+func CodeOf(err error) string {
+	var ae *AuthyError
+	if errors.As(err, &ae) {
+		return ae.Code
+	}
+	return ""
+}
+
+// ErrWriteVerifyFailed is returned when WithWriteVerify is enabled and a
+// secret read back after a write does not match the value written.
+var ErrWriteVerifyFailed = errors.New("authy: write verification failed")
+
+// ErrSecretEmpty is returned when the CLI reports a secret whose value is
+// null, such as a tombstoned entry.
+var ErrSecretEmpty = errors.New("authy: secret has no value")
+
+// ErrBinaryNotFound is returned when the authy binary cannot be found or
+// executed.
+var ErrBinaryNotFound = errors.New("authy: binary not found")
+
+// ErrStdinTimeout is returned when the CLI does not read its input within
+// the limit set by WithStdinTimeout.
+var ErrStdinTimeout = errors.New("authy: timed out writing stdin")
+
+// ErrTimeout is returned when a call exceeds the limit set by WithTimeout
+// or WithDefaultTimeout. The error also matches context.DeadlineExceeded;
+// it does not match ErrTimeout when the caller's own context expires.
+var ErrTimeout = errors.New("authy: call timed out")
+
+// ErrIncompatibleCLI is returned by New when WithMinVersion is set and the
+// authy CLI is older than the minimum.
+var ErrIncompatibleCLI = errors.New("authy: incompatible CLI version")
+
+// ErrJSONUnsupported is returned when the authy binary rejects the --json
+// flag or prints plain text in its place, which means it predates JSON
+// output and needs upgrading.
+var ErrJSONUnsupported = errors.New("authy: CLI does not support --json output")
+
+// ErrVersionConflict is returned by RotateIfVersion when the secret is not
+// at the expected version.
+var ErrVersionConflict = errors.New("authy: version conflict")
+
+// ErrNoAuditLog is returned by Audit when the vault has no audit log.
+var ErrNoAuditLog = errors.New("authy: no audit log")
+
 // jsonErrorResponse represents the JSON error format from authy --json stderr.
 type jsonErrorResponse struct {
 	Error jsonErrorDetail `json:"error"`
@@ -49,14 +135,59 @@ type jsonErrorDetail struct {
 	ExitCode int    `json:"exit_code"`
 }
 
+// invalidJSON reports CLI output that failed to decode. Output that is not
+// JSON at all is reported as ErrJSONUnsupported, without the output itself,
+// which may hold a secret.
+func invalidJSON(out []byte, err error) error {
+	if trimmed := bytes.TrimSpace(out); len(trimmed) > 0 && trimmed[0] != '{' && trimmed[0] != '[' {
+		return fmt.Errorf("%w: the CLI printed plain text; upgrade authy", ErrJSONUnsupported)
+	}
+	return fmt.Errorf("authy: invalid JSON output: %w", err)
+}
+
+// jsonFlagRejected reports whether stderr is an argument parsing error
+// about the --json flag, as printed by CLI releases that predate it.
+func jsonFlagRejected(stderr []byte) bool {
+	return bytes.Contains(stderr, []byte("'--json'")) &&
+		(bytes.Contains(stderr, []byte("unexpected argument")) || bytes.Contains(stderr, []byte("wasn't expected")))
+}
+
+// unknownSubcommand reports whether err is the CLI's argument parser
+// rejecting sub, as releases without that subcommand do.
+func unknownSubcommand(err error, sub string) bool {
+	var ae *AuthyError
+	return errors.As(err, &ae) && strings.Contains(ae.Message, "unrecognized subcommand '"+sub+"'")
+}
+
+// firstLine returns the first non-empty line of b, trimmed.
+func firstLine(b []byte) string {
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// isJSONError reports whether stderr holds an authy --json error response.
+func isJSONError(stderr []byte) bool {
+	var resp jsonErrorResponse
+	return json.Unmarshal(stderr, &resp) == nil && resp.Error.Code != ""
+}
+
 // parseError parses a JSON error from stderr, falling back to a generic error.
-func parseError(stderr []byte, exitCode int) error {
+func parseError(stderr []byte, exitCode int) *AuthyError {
+	var raw []byte
+	if len(stderr) > 0 {
+		raw = bytes.Clone(stderr)
+	}
 	var resp jsonErrorResponse
 	if err := json.Unmarshal(stderr, &resp); err == nil && resp.Error.Code != "" {
 		return &AuthyError{
 			ExitCode: resp.Error.ExitCode,
 			Code:     resp.Error.Code,
 			Message:  resp.Error.Message,
+			Raw:      raw,
 		}
 	}
 
@@ -69,6 +200,7 @@ func parseError(stderr []byte, exitCode int) error {
 		ExitCode: exitCode,
 		Code:     exitCodeToCode(exitCode),
 		Message:  msg,
+		Raw:      raw,
 	}
 }
 
@@ -92,3 +224,41 @@ func exitCodeToCode(exitCode int) string {
 		return "unknown_error"
 	}
 }
+
+const redactedText = "[REDACTED]"
+
+// redact returns err with every occurrence of value replaced, so that a
+// secret echoed back by the CLI (or by any wrapping) never reaches callers'
+// logs. An *AuthyError is copied with its Message and Raw scrubbed; any
+// other error containing value is replaced by one that hides the original
+// text but still matches it with errors.Is.
+func redact(err error, value string) error {
+	if err == nil || value == "" {
+		return err
+	}
+	if ae, ok := err.(*AuthyError); ok {
+		if !strings.Contains(ae.Message, value) && !bytes.Contains(ae.Raw, []byte(value)) {
+			return err
+		}
+		scrubbed := *ae
+		scrubbed.Message = strings.ReplaceAll(ae.Message, value, redactedText)
+		scrubbed.Raw = bytes.ReplaceAll(ae.Raw, []byte(value), []byte(redactedText))
+		return &scrubbed
+	}
+	if !strings.Contains(err.Error(), value) {
+		return err
+	}
+	return &redactedError{msg: strings.ReplaceAll(err.Error(), value, redactedText), err: err}
+}
+
+// redactedError hides the text of err. It deliberately has no Unwrap, so
+// the original message cannot be recovered from the chain.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+// Is reports whether the hidden error matches target.
+func (e *redactedError) Is(target error) bool { return errors.Is(e.err, target) }
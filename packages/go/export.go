@@ -0,0 +1,237 @@
+package authy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format is a serialization format for Export and Import.
+type Format string
+
+const (
+	// FormatDotenv is KEY=value lines, as written by ExportDotenv.
+	FormatDotenv Format = "env"
+	// FormatJSON is the array written by `authy export --format json`:
+	// objects with name, value, version, created, and modified fields.
+	FormatJSON Format = "json"
+	// FormatYAML holds the same entries as FormatJSON as a YAML sequence of
+	// mappings.
+	FormatYAML Format = "yaml"
+)
+
+// exportEntry is one secret in the JSON and YAML export formats.
+type exportEntry struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Version  int    `json:"version"`
+	Created  string `json:"created"`
+	Modified string `json:"modified"`
+}
+
+// Export writes secrets to w in the given format, optionally filtered by
+// WithScope and renamed with the env var naming options. The JSON and YAML
+// formats carry each secret's version and timestamps for backups and
+// migrations; dotenv carries values only.
+//
+// The output contains plaintext secrets: protect w accordingly. Internal
+// buffers are zeroed after writing.
+func (c *Client) Export(ctx context.Context, w io.Writer, format Format, opts ...CallOption) error {
+	switch format {
+	case FormatDotenv:
+		return c.ExportDotenv(ctx, w, opts...)
+	case FormatJSON, FormatYAML:
+	default:
+		return fmt.Errorf("authy: unknown export format %q", format)
+	}
+	cfg := c.newCallConfig(opts)
+	args := []string{"export", "--format", "json"}
+	if cfg.scope != "" {
+		args = append(args, "--scope", cfg.scope)
+	}
+	args = append(args, namingArgs(cfg)...)
+	out, err := c.runRaw(ctx, args, nil, cfg)
+	if err != nil {
+		return err
+	}
+	defer wipe(out)
+	if format == FormatJSON {
+		_, err = w.Write(out)
+		return err
+	}
+
+	var entries []exportEntry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return invalidJSON(out, err)
+	}
+	yaml := marshalExportYAML(entries)
+	defer wipe(yaml)
+	_, err = w.Write(yaml)
+	return err
+}
+
+// exportEntries reads the secrets for cfg's scope, or every secret, with
+// `authy export --format json`, renamed by the env var naming options.
+func (c *Client) exportEntries(ctx context.Context, cfg *callConfig) ([]exportEntry, error) {
+	args := []string{"export", "--format", "json"}
+	if cfg.scope != "" {
+		args = append(args, "--scope", cfg.scope)
+	}
+	args = append(args, namingArgs(cfg)...)
+	out, err := c.runRaw(ctx, args, nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(out)
+	var entries []exportEntry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, invalidJSON(out, err)
+	}
+	return entries, nil
+}
+
+// Import stores the secrets read from r in the given format. Dotenv input
+// is piped to `authy import -` as with ImportReader, with Force() and
+// WithScope translated to OnConflict(ConflictOverwrite) and ImportScope.
+// JSON and YAML input in the form Export writes is stored entry by entry as
+// with StoreAll, passing the options (such as Force) to each Store; a
+// secret that fails does not stop the rest.
+//
+// The CLI assigns versions and timestamps itself, so those fields are not
+// restored: each imported secret starts again at version 1. YAML input is
+// limited to what Export writes: a sequence of flat mappings whose values
+// are plain, single-quoted, or double-quoted scalars.
+func (c *Client) Import(ctx context.Context, r io.Reader, format Format, opts ...CallOption) error {
+	var entries []exportEntry
+	switch format {
+	case FormatDotenv:
+		cfg := c.newCallConfig(opts)
+		var importOpts []ImportOption
+		if cfg.force {
+			importOpts = append(importOpts, OnConflict(ConflictOverwrite))
+		}
+		if cfg.scope != "" {
+			importOpts = append(importOpts, ImportScope(cfg.scope))
+		}
+		return c.ImportReader(ctx, r, importOpts...)
+	case FormatJSON:
+		if err := json.NewDecoder(r).Decode(&entries); err != nil {
+			return fmt.Errorf("authy: invalid JSON import: %w", err)
+		}
+	case FormatYAML:
+		var err error
+		if entries, err = unmarshalExportYAML(r); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("authy: unknown import format %q", format)
+	}
+
+	secrets := make(map[string]string, len(entries))
+	for i, e := range entries {
+		if e.Name == "" {
+			return fmt.Errorf("authy: import entry %d has no name", i+1)
+		}
+		if _, dup := secrets[e.Name]; dup {
+			return fmt.Errorf("authy: import has duplicate secret %q", e.Name)
+		}
+		secrets[e.Name] = e.Value
+	}
+	return c.StoreAll(ctx, secrets, opts...)
+}
+
+// marshalExportYAML renders entries as a YAML sequence. Strings are written
+// double-quoted with Go escapes, which YAML also accepts.
+func marshalExportYAML(entries []exportEntry) []byte {
+	if len(entries) == 0 {
+		return []byte("[]\n")
+	}
+	var buf bytes.Buffer
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "- name: %s\n", strconv.Quote(e.Name))
+		fmt.Fprintf(&buf, "  value: %s\n", strconv.Quote(e.Value))
+		fmt.Fprintf(&buf, "  version: %d\n", e.Version)
+		fmt.Fprintf(&buf, "  created: %s\n", strconv.Quote(e.Created))
+		fmt.Fprintf(&buf, "  modified: %s\n", strconv.Quote(e.Modified))
+	}
+	return buf.Bytes()
+}
+
+// maxYAMLLine bounds a single line of YAML import input, which holds at most
+// one quoted value.
+const maxYAMLLine = 16 << 20
+
+// unmarshalExportYAML parses the YAML written by marshalExportYAML.
+func unmarshalExportYAML(r io.Reader) ([]exportEntry, error) {
+	var entries []exportEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxYAMLLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed == "---" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == "[]" && entries == nil {
+			entries = []exportEntry{}
+			continue
+		}
+		field := trimmed
+		if strings.HasPrefix(text, "- ") {
+			entries = append(entries, exportEntry{})
+			field = strings.TrimSpace(text[2:])
+		} else if len(entries) == 0 || !strings.HasPrefix(text, " ") {
+			return nil, fmt.Errorf("authy: invalid YAML import: line %d: expected a sequence entry", line)
+		}
+		key, raw, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("authy: invalid YAML import: line %d: expected key: value", line)
+		}
+		value, err := yamlScalar(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("authy: invalid YAML import: line %d: %w", line, err)
+		}
+		e := &entries[len(entries)-1]
+		switch strings.TrimSpace(key) {
+		case "name":
+			e.Name = value
+		case "value":
+			e.Value = value
+		case "version":
+			if e.Version, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("authy: invalid YAML import: line %d: invalid version %q", line, value)
+			}
+		case "created":
+			e.Created = value
+		case "modified":
+			e.Modified = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("authy: reading YAML import: %w", err)
+	}
+	return entries, nil
+}
+
+// yamlScalar decodes a plain, single-quoted, or double-quoted YAML scalar.
+func yamlScalar(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		return strconv.Unquote(raw)
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("unterminated single-quoted string")
+		}
+		return strings.ReplaceAll(raw[1:len(raw)-1], "''", "'"), nil
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+		return raw, nil
+	}
+}
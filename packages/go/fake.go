@@ -0,0 +1,280 @@
+package authy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretStore is the set of secret operations provided by Client. Code that
+// depends on SecretStore instead of *Client can be tested with FakeStore,
+// without an authy binary.
+type SecretStore interface {
+	Get(ctx context.Context, name string, opts ...CallOption) (string, error)
+	GetOpt(ctx context.Context, name string, opts ...CallOption) (string, bool, error)
+	Store(ctx context.Context, name, value string, opts ...CallOption) error
+	Remove(ctx context.Context, name string, opts ...CallOption) (bool, error)
+	Rotate(ctx context.Context, name, newValue string, opts ...CallOption) (int, error)
+	List(ctx context.Context, opts ...CallOption) ([]string, error)
+	Run(ctx context.Context, command []string, opts ...CallOption) (*RunResult, error)
+}
+
+var _ SecretStore = (*Client)(nil)
+var _ SecretStore = (*FakeStore)(nil)
+
+// FakeStore is an in-memory SecretStore for tests. It tracks versions and
+// scope policies like the authy CLI and returns the same sentinel errors. It
+// is safe for concurrent use.
+type FakeStore struct {
+	mu       sync.Mutex
+	secrets  map[string]fakeSecret
+	policies map[string]fakePolicy
+}
+
+type fakeSecret struct {
+	value   string
+	version int
+}
+
+type fakePolicy struct {
+	allow, deny []string
+}
+
+// NewFakeStore creates an empty FakeStore.
+func NewFakeStore() *FakeStore {
+	return &FakeStore{
+		secrets:  make(map[string]fakeSecret),
+		policies: make(map[string]fakePolicy),
+	}
+}
+
+// AddPolicy defines the scope used by WithScope, like `authy policy create`.
+// A secret is readable if its name matches an allow glob and no deny glob;
+// globs follow path.Match. Reading a secret outside the scope returns
+// ErrPolicyDenied; as with the CLI, an undefined scope is a not_found
+// error.
+func (f *FakeStore) AddPolicy(scope string, allow, deny []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policies[scope] = fakePolicy{allow: allow, deny: deny}
+}
+
+// checkScope reports whether name is readable under scope. Callers hold
+// f.mu.
+func (f *FakeStore) checkScope(scope, name string) error {
+	if scope == "" {
+		return nil
+	}
+	p, ok := f.policies[scope]
+	if !ok {
+		return &AuthyError{ExitCode: 3, Code: "not_found", Message: "Policy not found: " + scope}
+	}
+	if fakeMatch(p.deny, name) || !fakeMatch(p.allow, name) {
+		return &AuthyError{
+			ExitCode: 4,
+			Code:     "access_denied",
+			Message:  fmt.Sprintf("Access denied: secret '%s' not allowed by scope '%s'", name, scope),
+		}
+	}
+	return nil
+}
+
+func fakeMatch(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// visible returns the names readable under scope in sorted order, or an
+// error if the scope is undefined. Callers hold f.mu.
+func (f *FakeStore) visible(scope string) ([]string, error) {
+	if _, ok := f.policies[scope]; scope != "" && !ok {
+		return nil, f.checkScope(scope, "")
+	}
+	names := make([]string, 0, len(f.secrets))
+	for name := range f.secrets {
+		if f.checkScope(scope, name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Get returns the value of a secret, or ErrSecretNotFound.
+func (f *FakeStore) Get(ctx context.Context, name string, opts ...CallOption) (string, error) {
+	cfg := &callConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkScope(cfg.scope, name); err != nil {
+		return "", err
+	}
+	s, ok := f.secrets[name]
+	if !ok {
+		return "", secretNotFound(name)
+	}
+	return s.value, nil
+}
+
+// GetOpt returns the value of a secret and whether it exists.
+func (f *FakeStore) GetOpt(ctx context.Context, name string, opts ...CallOption) (string, bool, error) {
+	cfg := &callConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkScope(cfg.scope, name); err != nil {
+		return "", false, err
+	}
+	s, ok := f.secrets[name]
+	return s.value, ok, nil
+}
+
+// Store creates a secret at version 1. It returns ErrSecretAlreadyExists if
+// the secret exists, unless Force() is passed.
+func (f *FakeStore) Store(ctx context.Context, name, value string, opts ...CallOption) error {
+	cfg := &callConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkScope(cfg.scope, name); err != nil {
+		return err
+	}
+	if _, ok := f.secrets[name]; ok && !cfg.force {
+		return &AuthyError{
+			ExitCode: 5,
+			Code:     "already_exists",
+			Message:  fmt.Sprintf("Secret already exists: %s (use --force to overwrite)", name),
+		}
+	}
+	f.secrets[name] = fakeSecret{value: value, version: 1}
+	return nil
+}
+
+// Remove deletes a secret, or returns ErrSecretNotFound.
+func (f *FakeStore) Remove(ctx context.Context, name string, opts ...CallOption) (bool, error) {
+	cfg := &callConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkScope(cfg.scope, name); err != nil {
+		return false, err
+	}
+	if _, ok := f.secrets[name]; !ok {
+		return false, secretNotFound(name)
+	}
+	delete(f.secrets, name)
+	return true, nil
+}
+
+// Rotate replaces a secret's value and returns its new version, or
+// ErrSecretNotFound.
+func (f *FakeStore) Rotate(ctx context.Context, name, newValue string, opts ...CallOption) (int, error) {
+	cfg := &callConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkScope(cfg.scope, name); err != nil {
+		return 0, err
+	}
+	s, ok := f.secrets[name]
+	if !ok {
+		return 0, secretNotFound(name)
+	}
+	s.value = newValue
+	s.version++
+	f.secrets[name] = s
+	return s.version, nil
+}
+
+// List returns the names of all secrets in sorted order, filtered by
+// WithScope, WithPrefix, or WithGlob.
+func (f *FakeStore) List(ctx context.Context, opts ...CallOption) ([]string, error) {
+	cfg := &callConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	visible, err := f.visible(cfg.scope)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(visible))
+	for _, name := range visible {
+		if cfg.matchesName(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Run executes command directly with the secrets readable under WithScope
+// injected as environment variables, named as the CLI would with
+// WithUppercase, WithReplaceDash, WithEnvPrefix, or WithEnvMapping.
+func (f *FakeStore) Run(ctx context.Context, command []string, opts ...CallOption) (*RunResult, error) {
+	cfg := &callConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.checkInteractive(); err != nil {
+		return nil, err
+	}
+	if len(command) == 0 {
+		return nil, fmt.Errorf("authy: no command specified")
+	}
+
+	env := append(os.Environ(), cfg.childEnv...)
+	f.mu.Lock()
+	names, err := f.visible(cfg.scope)
+	for _, name := range names {
+		env = append(env, cfg.envName(name)+"="+f.secrets[name].value)
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := cfg.withTimeout(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = mergeEnv(env, nil)
+	return runChild(ctx, cmd, cfg, false)
+}
+
+// envName names the env var for a secret the way `authy run` does.
+func (cfg *callConfig) envName(name string) string {
+	if cfg.envMapping != nil {
+		return cfg.envMapping(name)
+	}
+	if cfg.replaceDash != 0 {
+		name = strings.ReplaceAll(name, "-", string(cfg.replaceDash))
+	}
+	if cfg.uppercase {
+		name = strings.ToUpper(name)
+	}
+	return cfg.envPrefix + name
+}
+
+// secretNotFound builds the error the CLI reports for a missing secret.
+func secretNotFound(name string) error {
+	return &AuthyError{ExitCode: 3, Code: "not_found", Message: "Secret not found: " + name}
+}
@@ -0,0 +1,101 @@
+package authy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// AlphabetAlphanumeric is the default alphabet used by Generate.
+const AlphabetAlphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+const defaultGenerateLength = 32
+
+// GenerateOption configures a Generate call.
+type GenerateOption func(*generateConfig)
+
+type generateConfig struct {
+	length   int
+	alphabet string
+	force    bool
+}
+
+// GenerateLength sets the number of characters to generate (default 32).
+func GenerateLength(n int) GenerateOption {
+	return func(c *generateConfig) {
+		c.length = n
+	}
+}
+
+// GenerateAlphabet sets the single-byte characters the value is drawn from
+// (default AlphabetAlphanumeric).
+func GenerateAlphabet(alphabet string) GenerateOption {
+	return func(c *generateConfig) {
+		c.alphabet = alphabet
+	}
+}
+
+// GenerateForce overwrites the secret if it already exists.
+func GenerateForce() GenerateOption {
+	return func(c *generateConfig) {
+		c.force = true
+	}
+}
+
+// Generate stores a new random secret under name. The authy CLI has no
+// generate subcommand, so the value is drawn from crypto/rand in this
+// process, passed to the CLI via stdin, and scrubbed from memory once stored.
+// Returns ErrSecretAlreadyExists if the secret exists (unless GenerateForce
+// is passed).
+func (c *Client) Generate(ctx context.Context, name string, opts ...GenerateOption) error {
+	gcfg := &generateConfig{length: defaultGenerateLength, alphabet: AlphabetAlphanumeric}
+	for _, opt := range opts {
+		opt(gcfg)
+	}
+	if gcfg.length <= 0 {
+		return fmt.Errorf("authy: generate length must be positive, got %d", gcfg.length)
+	}
+	if len(gcfg.alphabet) == 0 || len(gcfg.alphabet) > 256 {
+		return fmt.Errorf("authy: generate alphabet must hold 1 to 256 characters")
+	}
+
+	value, err := randomString(rand.Reader, gcfg.length, gcfg.alphabet)
+	if err != nil {
+		return err
+	}
+	defer wipe(value)
+	cfg := c.newCallConfig(nil)
+	cfg.force = gcfg.force
+	if err := c.store(ctx, name, bytes.NewReader(value), cfg); err != nil {
+		// Only copy the value into a string when there is an error to scrub.
+		return redact(err, string(value))
+	}
+	return nil
+}
+
+// randomString draws n characters uniformly from alphabet, rejecting random
+// bytes that would bias the result towards the start of the alphabet.
+func randomString(r io.Reader, n int, alphabet string) ([]byte, error) {
+	limit := 256 - 256%len(alphabet)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	defer wipe(buf)
+	for len(out) < n {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			wipe(out)
+			return nil, fmt.Errorf("authy: reading random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			out = append(out, alphabet[int(b)%len(alphabet)])
+			if len(out) == n {
+				break
+			}
+		}
+	}
+	return out, nil
+}
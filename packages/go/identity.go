@@ -0,0 +1,150 @@
+package authy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuthMethod is how the CLI authenticated a client.
+type AuthMethod string
+
+const (
+	// AuthPassphrase is the master passphrase.
+	AuthPassphrase AuthMethod = "passphrase"
+	// AuthKeyfile is the master keyfile.
+	AuthKeyfile AuthMethod = "keyfile"
+	// AuthToken is a session token, as issued by IssueToken.
+	AuthToken AuthMethod = "token"
+)
+
+// Identity describes the principal a client operates as, as returned by
+// WhoAmI.
+type Identity struct {
+	// Principal is the actor name the CLI records in the audit log, such as
+	// "master(keyfile)" or "token(<session id>)".
+	Principal string
+	Method    AuthMethod
+	// Scopes lists the scopes the identity can read under. A master
+	// identity can use every policy in the vault; a token is bound to its
+	// session's scope.
+	Scopes []string
+	// The remaining fields describe the session and are set only for
+	// AuthToken. Tokens are always read-only.
+	SessionID string
+	Label     string
+	RunOnly   bool
+	Expires   time.Time
+}
+
+// Master reports whether the identity holds the vault's master credentials,
+// which are not restricted by any policy and may write.
+func (id *Identity) Master() bool {
+	return id.Method != AuthToken
+}
+
+// HasScope reports whether the identity may read under scope.
+func (id *Identity) HasScope(scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type sessionListResponse struct {
+	Sessions []struct {
+		ID      string `json:"id"`
+		Scope   string `json:"scope"`
+		RunOnly bool   `json:"run_only"`
+		Label   string `json:"label"`
+		Expires string `json:"expires"`
+	} `json:"sessions"`
+}
+
+type policyListResponse struct {
+	Policies []struct {
+		Name string `json:"name"`
+	} `json:"policies"`
+}
+
+// WhoAmI reports the identity the client's credentials authenticate as. The
+// CLI has no identity command, so WhoAmI authenticates with a list, reads
+// the actor the CLI recorded for it from the audit log, and then fills in
+// the session's details from `authy session list` or, for a master
+// identity, the vault's policies from `authy policy list`.
+//
+// The audit lookup takes the newest list entry, so a client listing the
+// same vault at the same moment could be reported instead; the result is
+// meant for logging and preflight checks, not access control. It returns
+// ErrNoAuditLog if the vault has no audit log.
+func (c *Client) WhoAmI(ctx context.Context) (*Identity, error) {
+	// Audit timestamps have second precision.
+	since := time.Now().Truncate(time.Second)
+	if _, err := c.ListDetailed(ctx); err != nil {
+		return nil, err
+	}
+	entries, err := c.Audit(ctx, AuditSince(since))
+	if err != nil {
+		return nil, err
+	}
+	var actor string
+	for _, e := range entries {
+		if e.Action == "list" && e.Outcome == "success" {
+			actor = e.Actor
+		}
+	}
+	id, err := parseActor(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if id.Method != AuthToken {
+		var resp policyListResponse
+		if err := c.runCmd(ctx, []string{"policy", "list"}, nil, nil, &resp); err != nil {
+			return nil, err
+		}
+		id.Scopes = []string{}
+		for _, p := range resp.Policies {
+			id.Scopes = append(id.Scopes, p.Name)
+		}
+		return id, nil
+	}
+
+	var resp sessionListResponse
+	if err := c.runCmd(ctx, []string{"session", "list"}, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	for _, s := range resp.Sessions {
+		if s.ID != id.SessionID {
+			continue
+		}
+		id.Scopes = []string{s.Scope}
+		id.Label = s.Label
+		id.RunOnly = s.RunOnly
+		if id.Expires, err = parseTimestamp("expires", s.Expires); err != nil {
+			return nil, err
+		}
+		return id, nil
+	}
+	return nil, fmt.Errorf("authy: session %q missing from session list", id.SessionID)
+}
+
+// parseActor decodes an audit actor name into an Identity.
+func parseActor(actor string) (*Identity, error) {
+	switch {
+	case actor == "master(passphrase)":
+		return &Identity{Principal: actor, Method: AuthPassphrase}, nil
+	case actor == "master(keyfile)":
+		return &Identity{Principal: actor, Method: AuthKeyfile}, nil
+	case strings.HasPrefix(actor, "token(") && strings.HasSuffix(actor, ")"):
+		id := strings.TrimSuffix(strings.TrimPrefix(actor, "token("), ")")
+		return &Identity{Principal: actor, Method: AuthToken, SessionID: id}, nil
+	case actor == "":
+		return nil, fmt.Errorf("authy: no audit entry recorded the identity")
+	default:
+		return nil, fmt.Errorf("authy: unrecognized audit actor %q", actor)
+	}
+}
@@ -0,0 +1,151 @@
+package authy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Event describes a single invocation of the authy CLI. It never contains
+// secret values or the data passed on stdin.
+type Event struct {
+	// Subcommand is the authy subcommand that was run, e.g. "get".
+	Subcommand string
+	// Secret is the secret name the subcommand acted on, if any; for a
+	// rename, the old name. It is empty when names are redacted with
+	// WithRedactNames.
+	Secret string
+	// Duration is how long the subprocess took.
+	Duration time.Duration
+	// ExitCode is the subprocess exit code, or -1 if it did not exit.
+	ExitCode int
+	// ErrorCode is the authy error code (e.g. "not_found") on failure.
+	ErrorCode string
+	// Warning describes a non-fatal problem noticed by the client, such as
+	// an unrecognized CLI version.
+	Warning string
+}
+
+// WithLogger registers fn to be called after every authy invocation.
+func WithLogger(fn func(ctx context.Context, event Event)) Option {
+	return func(c *config) {
+		c.logger = fn
+	}
+}
+
+// WithSlog logs every authy invocation to logger, as a WithLogger callback
+// would: at Info level on success, and at Warn level when the invocation
+// failed or carries a warning. It replaces any WithLogger callback. Secret
+// names are included unless WithRedactNames is set; values never are.
+func WithSlog(logger *slog.Logger) Option {
+	return WithLogger(func(ctx context.Context, event Event) {
+		level := slog.LevelInfo
+		if event.ErrorCode != "" || event.Warning != "" {
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(ctx, level, "authy invocation", event.attrs()...)
+	})
+}
+
+// LogValue renders the event as a group of attributes for log/slog.
+func (e Event) LogValue() slog.Value {
+	return slog.GroupValue(e.attrs()...)
+}
+
+// attrs returns the event's fields as slog attributes, omitting empty ones.
+func (e Event) attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("subcommand", e.Subcommand),
+		slog.Duration("duration", e.Duration),
+		slog.Int("exit_code", e.ExitCode),
+	}
+	if e.Secret != "" {
+		attrs = append(attrs, slog.String("secret", e.Secret))
+	}
+	if e.ErrorCode != "" {
+		attrs = append(attrs, slog.String("error_code", e.ErrorCode))
+	}
+	if e.Warning != "" {
+		attrs = append(attrs, slog.String("warning", e.Warning))
+	}
+	return attrs
+}
+
+// WithRedactNames controls whether secret names are omitted from the events
+// passed to the WithLogger callback.
+func WithRedactNames(redact bool) Option {
+	return func(c *config) {
+		c.redactNames = redact
+	}
+}
+
+// secretNameArgs returns the positions of the secret names in args, which
+// depend on the subcommand: get, store, remove, rotate, and copy take one
+// name first, rename takes two, and `policy test` takes one after its
+// flags.
+func secretNameArgs(args []string) []int {
+	if len(args) < 2 {
+		return nil
+	}
+	switch args[0] {
+	case "get", "store", "remove", "rotate", "copy":
+		return []int{1}
+	case "rename":
+		if len(args) > 2 {
+			return []int{1, 2}
+		}
+		return []int{1}
+	case "policy":
+		if args[1] != "test" {
+			return nil
+		}
+		for i := 2; i < len(args); i++ {
+			if args[i] == "--scope" {
+				i++
+				continue
+			}
+			if !strings.HasPrefix(args[i], "-") {
+				return []int{i}
+			}
+		}
+	}
+	return nil
+}
+
+// secretName returns the first secret name in args, or "" if there is none
+// or names are redacted.
+func (c *Client) secretName(args []string) string {
+	names := secretNameArgs(args)
+	if len(names) == 0 || c.redactNames {
+		return ""
+	}
+	return args[names[0]]
+}
+
+// logEvent reports an invocation of args to the client's logger and
+// metrics, if any.
+func (c *Client) logEvent(ctx context.Context, args []string, start time.Time, exitCode int, err error) {
+	if len(args) == 0 {
+		return
+	}
+	duration := time.Since(start)
+	if c.metrics != nil {
+		c.metrics.ObserveCall(args[0], callCode(err), duration)
+	}
+	if c.logger == nil {
+		return
+	}
+	event := Event{
+		Subcommand: args[0],
+		Duration:   duration,
+		ExitCode:   exitCode,
+	}
+	event.Secret = c.secretName(args)
+	var ae *AuthyError
+	if errors.As(err, &ae) {
+		event.ErrorCode = ae.Code
+	}
+	c.logger(ctx, event)
+}
@@ -0,0 +1,55 @@
+package authy
+
+import (
+	"errors"
+	"time"
+)
+
+// Metrics receives counters and timings for the client's CLI invocations.
+// It keeps this package free of a metrics dependency; a Prometheus adapter
+// registers a counter vector and a histogram and forwards to them:
+//
+//	type promMetrics struct {
+//		calls    *prometheus.CounterVec   // authy_calls_total{op,code}
+//		duration *prometheus.HistogramVec // authy_call_duration_seconds{op}
+//		hits     prometheus.Counter       // authy_cache_hits_total
+//	}
+//
+//	func (m promMetrics) ObserveCall(op, code string, d time.Duration) {
+//		m.calls.WithLabelValues(op, code).Inc()
+//		m.duration.WithLabelValues(op).Observe(d.Seconds())
+//	}
+//
+//	func (m promMetrics) CacheHit(op string) { m.hits.Inc() }
+//
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveCall is called after every CLI invocation with the subcommand,
+	// the outcome code, and how long the subprocess took. code is "ok" on
+	// success, the authy error code (such as "auth_failed") for failures
+	// the CLI reported, or "client_error" for failures without one, such
+	// as timeouts.
+	ObserveCall(op, code string, duration time.Duration)
+	// CacheHit is called when a call is served from the WithCache cache
+	// without running the CLI.
+	CacheHit(op string)
+}
+
+// WithMetrics reports invocation counts, durations, and cache hits to m.
+func WithMetrics(m Metrics) Option {
+	return func(c *config) {
+		c.metrics = m
+	}
+}
+
+// callCode returns the outcome code reported to Metrics for err.
+func callCode(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var ae *AuthyError
+	if errors.As(err, &ae) {
+		return ae.Code
+	}
+	return "client_error"
+}
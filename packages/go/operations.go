@@ -1,86 +1,691 @@
 package authy
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // Get retrieves the value of a secret by name.
 // Returns ErrSecretNotFound if the secret does not exist.
-func (c *Client) Get(ctx context.Context, name string) (string, error) {
-	result, err := c.runCmd(ctx, []string{"get", name}, "")
-	if err != nil {
+func (c *Client) Get(ctx context.Context, name string, opts ...CallOption) (string, error) {
+	cfg := c.newCallConfig(opts)
+	var gen uint64
+	key := cacheKey{vault: cfg.vault, name: name, scope: cfg.scope, version: cfg.version}
+	if c.cache != nil {
+		var value string
+		var hit bool
+		if value, gen, hit = c.cache.get(key); hit {
+			if c.metrics != nil {
+				c.metrics.CacheHit("get")
+			}
+			return value, nil
+		}
+	}
+	var resp getResponse
+	if err := c.runCmd(ctx, getArgs(name, cfg), nil, cfg, &resp); err != nil {
 		return "", err
 	}
-	value, ok := result["value"].(string)
-	if !ok {
-		return "", fmt.Errorf("authy: unexpected response format")
+	if resp.Value == nil {
+		return "", resp.valueError()
 	}
-	return value, nil
+	if c.cache != nil {
+		c.cache.put(key, *resp.Value, gen)
+	}
+	return *resp.Value, nil
+}
+
+// GetVersion retrieves the value of a specific version of a secret. It
+// returns ErrVersionNotFound if the secret exists but not at that version.
+func (c *Client) GetVersion(ctx context.Context, name string, version int, opts ...CallOption) (string, error) {
+	return c.Get(ctx, name, append(opts, WithVersion(version))...)
+}
+
+// getArgs builds the arguments for the get subcommand.
+func getArgs(name string, cfg *callConfig) []string {
+	args := []string{"get", name}
+	if cfg.scope != "" {
+		args = append(args, "--scope", cfg.scope)
+	}
+	if cfg.version > 0 {
+		args = append(args, "--version", strconv.Itoa(cfg.version))
+	}
+	return args
 }
 
 // GetOpt retrieves a secret, returning (value, true, nil) if found, or
 // ("", false, nil) if the secret does not exist. Other errors are returned
 // as the third value.
-func (c *Client) GetOpt(ctx context.Context, name string) (string, bool, error) {
-	result, err := c.runCmd(ctx, []string{"get", name}, "")
-	if err != nil {
+func (c *Client) GetOpt(ctx context.Context, name string, opts ...CallOption) (string, bool, error) {
+	cfg := c.newCallConfig(opts)
+	var resp getResponse
+	if err := c.runCmd(ctx, getArgs(name, cfg), nil, cfg, &resp); err != nil {
 		if isNotFound(err) {
 			return "", false, nil
 		}
 		return "", false, err
 	}
-	value, ok := result["value"].(string)
+	if resp.Value == nil {
+		if err := resp.valueError(); !isNotFound(err) {
+			return "", false, err
+		}
+		return "", false, nil
+	}
+	return *resp.Value, true, nil
+}
+
+// GetOr retrieves a secret, returning def if it does not exist. Other
+// errors, such as ErrAuthFailed or ErrPolicyDenied, are returned unchanged.
+func (c *Client) GetOr(ctx context.Context, name, def string) (string, error) {
+	value, ok, err := c.GetOpt(ctx, name)
+	if err != nil {
+		return "", err
+	}
 	if !ok {
-		return "", false, fmt.Errorf("authy: unexpected response format")
+		return def, nil
+	}
+	return value, nil
+}
+
+// Exists reports whether a secret exists. It looks the name up in the
+// streamed output of `authy list`, which carries metadata only, so the
+// value never reaches this process; the listing stops once the name is
+// found. With WithScope, a secret the scope cannot read reports false.
+// WithVersion needs the value-bearing get subcommand instead, whose raw
+// output is scrubbed without being decoded. Errors other than not-found are
+// returned unchanged.
+func (c *Client) Exists(ctx context.Context, name string, opts ...CallOption) (bool, error) {
+	cfg := c.newCallConfig(opts)
+	if cfg.version > 0 {
+		out, err := c.runRaw(ctx, getArgs(name, cfg), nil, cfg)
+		if err != nil {
+			if isNotFound(err) || errors.Is(err, ErrVersionNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		wipe(out)
+		return true, nil
+	}
+	_, found, err := c.lookup(ctx, name, opts)
+	return found, err
+}
+
+// lookup finds name in the streamed listing, stopping once it is seen.
+func (c *Client) lookup(ctx context.Context, name string, opts []CallOption) (ListResult, bool, error) {
+	var found *ListResult
+	err := c.ListStream(ctx, func(entry ListResult) error {
+		if entry.Name == name {
+			found = &entry
+			return errStopIteration
+		}
+		return nil
+	}, opts...)
+	if err != nil && err != errStopIteration {
+		return ListResult{}, false, err
 	}
-	return value, true, nil
+	if found == nil {
+		return ListResult{}, false, nil
+	}
+	return *found, true, nil
+}
+
+// SecretMetadata holds the non-sensitive fields of a secret.
+type SecretMetadata struct {
+	Name     string
+	Version  int
+	Created  time.Time
+	Modified time.Time
+	// ExpiresAt is when the secret expires, or nil if it was stored
+	// without WithTTL or WithExpiry.
+	ExpiresAt *time.Time
+	// Tags and Description are set by WithTags and WithDescription. They
+	// are empty if the CLI does not report them.
+	Tags        map[string]string
+	Description string
+}
+
+// GetMetadata retrieves a secret's version and timestamps without returning
+// its value. It looks the name up in the metadata-only listing, as Exists
+// does, so the value is never decrypted; with WithScope, a secret the scope
+// cannot read is not found. WithVersion needs the value-bearing get
+// subcommand instead. Returns ErrSecretNotFound if the secret does not
+// exist.
+func (c *Client) GetMetadata(ctx context.Context, name string, opts ...CallOption) (SecretMetadata, error) {
+	cfg := c.newCallConfig(opts)
+	if cfg.version > 0 {
+		var resp getResponse
+		if err := c.runCmd(ctx, getArgs(name, cfg), nil, cfg, &resp); err != nil {
+			return SecretMetadata{}, err
+		}
+		return parseMetadata(name, &resp)
+	}
+	entry, found, err := c.lookup(ctx, name, opts)
+	if err != nil {
+		return SecretMetadata{}, err
+	}
+	if !found {
+		return SecretMetadata{}, secretNotFound(name)
+	}
+	meta := SecretMetadata{
+		Name:        entry.Name,
+		Version:     entry.Version,
+		Tags:        entry.Tags,
+		Description: entry.Description,
+	}
+	if meta.Created, err = parseTimestamp("created", entry.Created); err != nil {
+		return SecretMetadata{}, err
+	}
+	if meta.Modified, err = parseTimestamp("modified", entry.Modified); err != nil {
+		return SecretMetadata{}, err
+	}
+	if entry.Expires != "" {
+		expires, err := parseTimestamp("expires_at", entry.Expires)
+		if err != nil {
+			return SecretMetadata{}, err
+		}
+		meta.ExpiresAt = &expires
+	}
+	return meta, nil
+}
+
+// parseMetadata extracts SecretMetadata from a get response.
+func parseMetadata(name string, resp *getResponse) (SecretMetadata, error) {
+	if resp.Version == nil {
+		return SecretMetadata{}, fmt.Errorf("authy: unexpected response format for version")
+	}
+	meta := SecretMetadata{
+		Name:        name,
+		Version:     *resp.Version,
+		Tags:        resp.Tags,
+		Description: resp.Description,
+	}
+	if resp.Name != "" {
+		meta.Name = resp.Name
+	}
+	var err error
+	if meta.Created, err = parseTimestamp("created", resp.Created); err != nil {
+		return SecretMetadata{}, err
+	}
+	if meta.Modified, err = parseTimestamp("modified", resp.Modified); err != nil {
+		return SecretMetadata{}, err
+	}
+	if resp.ExpiresAt != "" {
+		expires, err := parseTimestamp("expires_at", resp.ExpiresAt)
+		if err != nil {
+			return SecretMetadata{}, err
+		}
+		meta.ExpiresAt = &expires
+	}
+	return meta, nil
+}
+
+// parseTimestamp parses raw, the RFC3339 timestamp in the named field.
+func parseTimestamp(key, raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("authy: unexpected response format for %s", key)
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("authy: invalid %s timestamp: %w", key, err)
+	}
+	return t, nil
 }
 
 // Store creates a new secret. Returns ErrSecretAlreadyExists if the secret
 // already exists (unless Force() is passed).
 // The secret value is passed via stdin, never as a command-line argument.
 func (c *Client) Store(ctx context.Context, name, value string, opts ...CallOption) error {
-	cfg := &callConfig{}
-	for _, opt := range opts {
-		opt(cfg)
+	cfg := c.newCallConfig(opts)
+	return redact(c.storeValue(ctx, name, value, cfg), value)
+}
+
+// storeValue stores value and, with WithWriteVerify, reads it back.
+func (c *Client) storeValue(ctx context.Context, name, value string, cfg *callConfig) error {
+	if err := c.store(ctx, name, strings.NewReader(value), cfg); err != nil {
+		return err
+	}
+	if c.writeVerify {
+		var resp getResponse
+		if err := c.runCmd(ctx, []string{"get", name}, nil, cfg, &resp); err != nil {
+			return err
+		}
+		return verifyWrite(&resp, value)
+	}
+	return nil
+}
+
+// StoreReader creates a new secret whose value is streamed from r to the
+// CLI's stdin, without buffering it in memory. It honors Force() like Store.
+// WithWriteVerify does not apply, since the written value is not retained.
+func (c *Client) StoreReader(ctx context.Context, name string, r io.Reader, opts ...CallOption) error {
+	cfg := c.newCallConfig(opts)
+	return c.store(ctx, name, r, cfg)
+}
+
+// store runs the store subcommand with the value read from r.
+func (c *Client) store(ctx context.Context, name string, r io.Reader, cfg *callConfig) error {
+	if err := c.checkScope(ctx, name, cfg); err != nil {
+		return err
 	}
+	defer c.InvalidateCache(name)
 	args := []string{"store", name}
 	if cfg.force {
 		args = append(args, "--force")
 	}
-	_, err := c.runCmd(ctx, args, value)
-	return err
+	meta, err := metadataArgs(cfg)
+	if err != nil {
+		return err
+	}
+	return c.runCmd(ctx, append(args, meta...), r, cfg, nil)
+}
+
+// metadataArgs builds the --ttl, --tag, and --description flags for the
+// store and rotate subcommands.
+func metadataArgs(cfg *callConfig) ([]string, error) {
+	var args []string
+	ttl := cfg.ttl
+	if !cfg.expiry.IsZero() {
+		if ttl != 0 {
+			return nil, fmt.Errorf("authy: WithTTL and WithExpiry cannot be combined")
+		}
+		remaining := time.Until(cfg.expiry)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("authy: expiry %s is in the past", cfg.expiry.Format(time.RFC3339))
+		}
+		if ttl = remaining.Truncate(time.Second); ttl < remaining {
+			ttl += time.Second
+		}
+	}
+	if ttl != 0 {
+		if ttl < time.Second {
+			return nil, fmt.Errorf("authy: TTL must be at least one second, got %s", ttl)
+		}
+		args = append(args, "--ttl", strconv.FormatInt(int64(ttl/time.Second), 10)+"s")
+	}
+	keys := make([]string, 0, len(cfg.tags))
+	for k := range cfg.tags {
+		if k == "" || strings.Contains(k, "=") {
+			return nil, fmt.Errorf("authy: invalid tag key %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--tag", k+"="+cfg.tags[k])
+	}
+	if cfg.description != "" {
+		args = append(args, "--description", cfg.description)
+	}
+	return args, nil
+}
+
+// StoreBytes creates a new secret from binary data. The authy CLI only holds
+// UTF-8 text and strips trailing newlines, so the value is base64-encoded
+// before being passed via stdin. The encoded copy is zeroed afterwards, and
+// with WithWriteVerify the value is read back with GetBytes and compared.
+// Read it back with GetBytes.
+func (c *Client) StoreBytes(ctx context.Context, name string, value []byte, opts ...CallOption) error {
+	cfg := c.newCallConfig(opts)
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(value)))
+	base64.StdEncoding.Encode(encoded, value)
+	defer wipe(encoded)
+
+	err := c.store(ctx, name, bytes.NewReader(encoded), cfg)
+	if err == nil && c.writeVerify {
+		var stored []byte
+		if stored, err = c.GetBytes(ctx, name); err == nil {
+			if subtle.ConstantTimeCompare(stored, value) != 1 {
+				err = ErrWriteVerifyFailed
+			}
+			wipe(stored)
+		}
+	}
+	if err != nil {
+		// Only copy the value into strings when there is an error to scrub.
+		return redact(redact(err, string(encoded)), string(value))
+	}
+	return nil
+}
+
+// GetBytes retrieves a secret stored with StoreBytes, decoding its base64
+// value. Intermediate buffers holding the encoded value are zeroed.
+// Returns ErrSecretNotFound if the secret does not exist.
+func (c *Client) GetBytes(ctx context.Context, name string, opts ...CallOption) ([]byte, error) {
+	secret, err := c.GetSecret(ctx, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Destroy()
+
+	encoded := secret.Bytes()
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(data, encoded)
+	if err != nil {
+		wipe(data)
+		return nil, fmt.Errorf("authy: secret %q is not base64-encoded binary: %w", name, err)
+	}
+	return data[:n], nil
 }
 
 // Remove deletes a secret by name. Returns true if the secret was removed,
 // or an error (including ErrSecretNotFound) if it did not exist.
-func (c *Client) Remove(ctx context.Context, name string) (bool, error) {
-	_, err := c.runCmd(ctx, []string{"remove", name}, "")
+func (c *Client) Remove(ctx context.Context, name string, opts ...CallOption) (bool, error) {
+	cfg := c.newCallConfig(opts)
+	if err := c.checkScope(ctx, name, cfg); err != nil {
+		return false, err
+	}
+	defer c.InvalidateCache(name)
+	err := c.runCmd(ctx, []string{"remove", name}, nil, cfg, nil)
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+// Rename changes a secret's name in place via `authy rename`, keeping its
+// value and version history inside the vault; no value passes through this
+// process. Returns ErrSecretNotFound if oldName does not exist and
+// ErrSecretAlreadyExists if newName is taken.
+func (c *Client) Rename(ctx context.Context, oldName, newName string, opts ...CallOption) error {
+	cfg := c.newCallConfig(opts)
+	defer c.InvalidateCache(newName)
+	defer c.InvalidateCache(oldName)
+	return c.runCmd(ctx, []string{"rename", oldName, newName}, nil, cfg, nil)
+}
+
+// Copy duplicates a secret from one scope into another via `authy copy`,
+// so the value stays inside the CLI. It honors Force() to overwrite the
+// destination and returns ErrSecretNotFound or ErrSecretAlreadyExists as
+// usual.
+//
+// CLI releases without a copy subcommand keep a single namespace, with
+// scopes as read policies over it, so there is nothing to copy between; Copy
+// returns an error wrapping errors.ErrUnsupported for them.
+func (c *Client) Copy(ctx context.Context, name, fromScope, toScope string, opts ...CallOption) error {
+	cfg := c.newCallConfig(opts)
+	args := []string{"copy", name, "--from-scope", fromScope, "--to-scope", toScope}
+	if cfg.force {
+		args = append(args, "--force")
+	}
+	defer c.InvalidateCache(name)
+	err := c.runCmd(ctx, args, nil, cfg, nil)
+	if unknownSubcommand(err, "copy") {
+		return fmt.Errorf("authy: the CLI has no copy subcommand: %w", errors.ErrUnsupported)
+	}
+	return err
+}
+
+// CopyAs duplicates the secret src under the name dst, carrying over its
+// tags, description, and expiry; options passed explicitly (such as WithTags
+// or WithTTL) take precedence. WithVersion copies an older version of src.
+// It honors Force() to overwrite dst and returns ErrSecretNotFound or
+// ErrSecretAlreadyExists as usual.
+//
+// The CLI has no name-to-name copy, so the value is read with get and
+// written with store: it passes through this process's memory, and dst
+// starts its own history at version 1. Use Rename to move a secret with its
+// history intact.
+func (c *Client) CopyAs(ctx context.Context, src, dst string, opts ...CallOption) error {
+	cfg := c.newCallConfig(opts)
+	if err := c.checkScope(ctx, src, cfg); err != nil {
+		return err
+	}
+	var resp getResponse
+	if err := c.runCmd(ctx, getArgs(src, cfg), nil, cfg, &resp); err != nil {
+		return err
+	}
+	if resp.Value == nil {
+		return resp.valueError()
+	}
+	meta, err := parseMetadata(src, &resp)
+	if err != nil {
+		return err
+	}
+
+	carried := []CallOption{WithTags(meta.Tags), WithDescription(meta.Description)}
+	if meta.ExpiresAt != nil && cfg.ttl == 0 && cfg.expiry.IsZero() && meta.ExpiresAt.After(time.Now()) {
+		carried = append(carried, WithExpiry(*meta.ExpiresAt))
+	}
+	return c.Store(ctx, dst, *resp.Value, append(carried, opts...)...)
+}
+
 // Rotate updates the value of an existing secret and increments its version.
-// Returns the new version number. The new value is passed via stdin.
-func (c *Client) Rotate(ctx context.Context, name, newValue string) (int, error) {
-	_, err := c.runCmd(ctx, []string{"rotate", name}, newValue)
+// Returns the new version number, as reported by the rotate command itself
+// so a concurrent writer cannot be mistaken for this one. The new value is
+// passed via stdin.
+func (c *Client) Rotate(ctx context.Context, name, newValue string, opts ...CallOption) (int, error) {
+	version, err := c.rotate(ctx, name, newValue, opts)
+	return version, redact(err, newValue)
+}
+
+// Upsert creates the secret if it is absent and rotates it otherwise,
+// reporting which happened and the resulting version. Unlike Store with
+// Force, an existing secret keeps its history: its version is bumped
+// rather than reset to 1. It tries store first and falls back to rotate on
+// ErrSecretAlreadyExists, retrying once if the secret disappears between
+// the two, so no read of the old value is needed. The options (such as
+// WithScope or WithTags) apply to whichever write runs. Force is ignored:
+// a forced store would overwrite an existing secret while reporting it as
+// created.
+func (c *Client) Upsert(ctx context.Context, name, value string, opts ...CallOption) (created bool, version int, err error) {
+	opts = append(opts[:len(opts):len(opts)], func(c *callConfig) { c.force = false })
+	for attempt := 0; attempt < 2; attempt++ {
+		err = c.Store(ctx, name, value, opts...)
+		if err == nil {
+			return true, 1, nil
+		}
+		if !errors.Is(err, ErrSecretAlreadyExists) {
+			return false, 0, err
+		}
+		version, err = c.Rotate(ctx, name, value, opts...)
+		if err == nil {
+			return false, version, nil
+		}
+		if !isNotFound(err) {
+			return false, 0, err
+		}
+	}
+	return false, 0, err
+}
+
+// RotateIfVersion rotates the secret only if its current version is
+// expectedVersion, returning ErrVersionConflict otherwise, so that
+// concurrent pipelines do not silently overwrite each other. The CLI has
+// no compare-and-swap, so the version is checked from the listing just
+// before rotating. Writes from this client are serialized, but another
+// process can still rotate in between: that is detected afterwards when
+// the new version is not expectedVersion+1, and reported as
+// ErrVersionConflict along with the version written.
+func (c *Client) RotateIfVersion(ctx context.Context, name, newValue string, expectedVersion int, opts ...CallOption) (int, error) {
+	entry, found, err := c.lookup(ctx, name, opts)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, secretNotFound(name)
+	}
+	if entry.Version != expectedVersion {
+		return 0, fmt.Errorf("%w: %q is at version %d, expected %d", ErrVersionConflict, name, entry.Version, expectedVersion)
+	}
+	version, err := c.Rotate(ctx, name, newValue, opts...)
+	if err != nil {
+		return 0, err
+	}
+	if version != expectedVersion+1 {
+		return version, fmt.Errorf("%w: %q was rotated concurrently; wrote version %d over an expected %d", ErrVersionConflict, name, version, expectedVersion)
+	}
+	return version, nil
+}
+
+// Rollback restores the value a secret had at toVersion by rotating it back
+// in, so the restored value becomes a new version rather than rewinding the
+// counter. The CLI has no rollback subcommand: the old value is read with
+// GetVersion, which returns ErrVersionNotFound if the CLI did not retain
+// it. The options (such as WithScope) apply to both steps.
+func (c *Client) Rollback(ctx context.Context, name string, toVersion int, opts ...CallOption) error {
+	if toVersion <= 0 {
+		return fmt.Errorf("authy: invalid version %d", toVersion)
+	}
+	value, err := c.GetVersion(ctx, name, toVersion, opts...)
 	if err != nil {
+		return err
+	}
+	_, err = c.Rotate(ctx, name, value, opts...)
+	return err
+}
+
+// rotate implements Rotate; errors it returns are redacted by the caller.
+func (c *Client) rotate(ctx context.Context, name, newValue string, opts []CallOption) (int, error) {
+	cfg := c.newCallConfig(opts)
+	if err := c.checkScope(ctx, name, cfg); err != nil {
 		return 0, err
 	}
-	// The rotate command does not return JSON output with the version,
-	// so we fetch the secret to get the current version.
-	result, err := c.runCmd(ctx, []string{"get", name}, "")
+	meta, err := metadataArgs(cfg)
 	if err != nil {
 		return 0, err
 	}
-	version, ok := result["version"].(float64)
+	defer c.InvalidateCache(name)
+	// The version is read from the rotate process's own output: a separate
+	// get or list could observe a concurrent writer's version instead.
+	var diag bytes.Buffer
+	rotateCfg := *cfg
+	rotateCfg.diagnostics = &diag
+	if cfg.diagnostics != nil {
+		rotateCfg.diagnostics = io.MultiWriter(&diag, cfg.diagnostics)
+	}
+	var rotated rotateResponse
+	if err := c.runCmd(ctx, append([]string{"rotate", name}, meta...), strings.NewReader(newValue), &rotateCfg, &rotated); err != nil {
+		return 0, err
+	}
+	version, ok := 0, false
+	if rotated.Version != nil {
+		version, ok = *rotated.Version, true
+	} else {
+		// Current CLI releases report the new version only on stderr.
+		version, ok = rotatedVersion(diag.Bytes())
+	}
 	if !ok {
-		return 0, fmt.Errorf("authy: unexpected response format for version")
+		return 0, fmt.Errorf("authy: rotate of %q did not report the new version", name)
+	}
+	if c.writeVerify {
+		// Verification needs the stored value back, so a get is unavoidable.
+		var resp getResponse
+		if err := c.runCmd(ctx, []string{"get", name}, nil, cfg, &resp); err != nil {
+			return 0, err
+		}
+		if err := verifyWrite(&resp, newValue); err != nil {
+			return 0, err
+		}
 	}
-	return int(version), nil
+	return version, nil
+}
+
+// rotatedVersionPattern matches the CLI's "Secret 'name' rotated to version
+// N." message.
+var rotatedVersionPattern = regexp.MustCompile(`rotated to version (\d+)`)
+
+// rotatedVersion extracts the new version from rotate's stderr.
+func rotatedVersion(stderr []byte) (int, bool) {
+	m := rotatedVersionPattern.FindSubmatch(stderr)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.Atoi(string(m[1]))
+	return v, err == nil
+}
+
+// checkScope enforces WithScope for writes. The CLI's store, remove, and
+// rotate subcommands take no scope, so the name is checked first with
+// `authy policy test`, and ErrPolicyDenied is returned if the scope cannot
+// read it.
+func (c *Client) checkScope(ctx context.Context, name string, cfg *callConfig) error {
+	if cfg.scope == "" {
+		return nil
+	}
+	var resp struct {
+		Allowed bool `json:"allowed"`
+	}
+	if err := c.runCmd(ctx, []string{"policy", "test", "--scope", cfg.scope, name}, nil, cfg, &resp); err != nil {
+		return err
+	}
+	if !resp.Allowed {
+		return &AuthyError{
+			ExitCode: 4,
+			Code:     "access_denied",
+			Message:  fmt.Sprintf("Access denied: secret '%s' not allowed by scope '%s'", name, cfg.scope),
+		}
+	}
+	return nil
+}
+
+// verifyWrite compares the value in a get response with the value that was
+// written, in constant time. The CLI strips trailing newlines on write, so
+// the expected value is trimmed the same way.
+func verifyWrite(resp *getResponse, written string) error {
+	if resp.Value == nil {
+		return resp.valueError()
+	}
+	expected := strings.TrimRight(written, "\n")
+	if subtle.ConstantTimeCompare([]byte(*resp.Value), []byte(expected)) != 1 {
+		return ErrWriteVerifyFailed
+	}
+	return nil
+}
+
+// WithOverride sets name to value for the duration of fn, then restores
+// the previous state. An existing secret is rotated to value and rotated
+// back to its prior value afterwards, so its version history is kept; a
+// secret that did not exist is stored and then removed. Restoration runs
+// even if fn panics, and uses a context detached from ctx's cancellation so
+// cleanup is not skipped.
+//
+// The override is not atomic. Other clients sharing the vault observe the
+// overridden value while fn runs, and changes they make to name in the
+// meantime are overwritten on restore.
+func (c *Client) WithOverride(ctx context.Context, name, value string, fn func(ctx context.Context) error) (err error) {
+	prior, existed, err := c.GetOpt(ctx, name)
+	if err != nil {
+		return err
+	}
+	if existed {
+		_, err = c.Rotate(ctx, name, value)
+	} else {
+		err = c.Store(ctx, name, value, Force())
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		restoreCtx := context.WithoutCancel(ctx)
+		var restoreErr error
+		if existed {
+			_, restoreErr = c.Rotate(restoreCtx, name, prior)
+		} else {
+			_, restoreErr = c.Remove(restoreCtx, name)
+		}
+		if restoreErr != nil {
+			err = errors.Join(err, fmt.Errorf("authy: failed to restore %q: %w", name, restoreErr))
+		}
+	}()
+
+	return fn(ctx)
 }
 
 // ListResult holds a single entry from the list output.
@@ -89,85 +694,900 @@ type ListResult struct {
 	Version  int
 	Created  string
 	Modified string
+	// Tags and Description are as in SecretMetadata.
+	Tags        map[string]string
+	Description string
+	// Expires is when the secret expires, for CLI releases that list it.
+	Expires string `json:"expires_at"`
+	// CreatedAt and ModifiedAt are Created and Modified parsed as RFC3339;
+	// they are zero if the CLI omitted the field or it did not parse.
+	CreatedAt  time.Time `json:"-"`
+	ModifiedAt time.Time `json:"-"`
+}
+
+// parseTimes fills CreatedAt and ModifiedAt from their string forms.
+func (e *ListResult) parseTimes() {
+	e.CreatedAt, _ = time.Parse(time.RFC3339, e.Created)
+	e.ModifiedAt, _ = time.Parse(time.RFC3339, e.Modified)
 }
 
-// List returns the names of all secrets, optionally filtered by scope.
+// List returns the names of all secrets, optionally filtered by scope,
+// WithPrefix, or WithGlob.
 func (c *Client) List(ctx context.Context, opts ...CallOption) ([]string, error) {
-	cfg := &callConfig{}
-	for _, opt := range opts {
-		opt(cfg)
+	entries, err := c.ListDetailed(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	return names, nil
+}
+
+// ListDetailed returns every secret with its version and timestamps,
+// optionally filtered by scope, WithPrefix, or WithGlob.
+func (c *Client) ListDetailed(ctx context.Context, opts ...CallOption) ([]ListResult, error) {
+	cfg := c.newCallConfig(opts)
+	if cfg.nameGlob != "" {
+		if _, err := path.Match(cfg.nameGlob, ""); err != nil {
+			return nil, fmt.Errorf("authy: invalid glob %q: %w", cfg.nameGlob, err)
+		}
 	}
 	args := []string{"list"}
 	if cfg.scope != "" {
 		args = append(args, "--scope", cfg.scope)
 	}
-	result, err := c.runCmd(ctx, args, "")
-	if err != nil {
+	var resp listResponse
+	if err := c.runCmd(ctx, args, nil, cfg, &resp); err != nil {
 		return nil, err
 	}
-	if result == nil {
-		return []string{}, nil
+
+	entries := make([]ListResult, 0, len(resp.Secrets))
+	for _, entry := range resp.Secrets {
+		entry.parseTimes()
+		if entry.Name == "" || !cfg.matches(&entry) {
+			continue
+		}
+		entries = append(entries, entry)
 	}
+	return entries, nil
+}
 
-	secretsRaw, ok := result["secrets"].([]any)
-	if !ok {
-		return []string{}, nil
+// errStopIteration ends a ListStream early when a ListIter consumer stops.
+var errStopIteration = errors.New("authy: iteration stopped")
+
+// ListIter returns an iterator over the secrets ListStream would visit,
+// decoded incrementally as the CLI prints them. Its signature matches
+// iter.Seq2[ListResult, error], so with Go 1.23 or later it can be ranged
+// over directly:
+//
+//	for entry, err := range client.ListIter(ctx) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// A failure is yielded once, as the final pair, with a zero ListResult.
+// Stopping the loop early kills the subprocess.
+func (c *Client) ListIter(ctx context.Context, opts ...CallOption) func(yield func(ListResult, error) bool) {
+	return func(yield func(ListResult, error) bool) {
+		err := c.ListStream(ctx, func(entry ListResult) error {
+			if !yield(entry, nil) {
+				return errStopIteration
+			}
+			return nil
+		}, opts...)
+		if err != nil && err != errStopIteration {
+			yield(ListResult{}, err)
+		}
 	}
+}
 
-	names := make([]string, 0, len(secretsRaw))
-	for _, item := range secretsRaw {
-		m, ok := item.(map[string]any)
-		if !ok {
+// ListStream is like ListDetailed but decodes the CLI's output
+// incrementally and calls fn for each secret as it is read, so large vaults
+// are never held in memory at once. If fn returns an error, the subprocess
+// is killed and that error is returned.
+func (c *Client) ListStream(ctx context.Context, fn func(ListResult) error, opts ...CallOption) error {
+	cfg := c.newCallConfig(opts)
+	if cfg.nameGlob != "" {
+		if _, err := path.Match(cfg.nameGlob, ""); err != nil {
+			return fmt.Errorf("authy: invalid glob %q: %w", cfg.nameGlob, err)
+		}
+	}
+	args := []string{"list"}
+	if cfg.scope != "" {
+		args = append(args, "--scope", cfg.scope)
+	}
+
+	ctx, cancel := c.withTimeout(ctx, cfg)
+	defer cancel()
+	// A failure can be retried only while fn has seen nothing, so entries
+	// are never delivered twice.
+	for attempt := 1; ; attempt++ {
+		delivered := false
+		err := c.listStreamOnce(ctx, args, cfg, func(entry ListResult) error {
+			delivered = true
+			return fn(entry)
+		})
+		if err == nil || delivered || attempt >= c.retry.attempts || !c.retry.shouldRetry(args, nil, cfg, err) {
+			return err
+		}
+		if !c.retry.wait(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+// listStreamOnce runs a single streamed list, with the same tracing and
+// logging as runOnce. The subprocess is killed as soon as fn or decoding
+// fails, so a child blocked writing to a full pipe cannot hang the call.
+func (c *Client) listStreamOnce(ctx context.Context, args []string, cfg *callConfig, fn func(ListResult) error) error {
+	ctx, endSpan := c.startSpan(ctx, args, cfg)
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	cmd, cleanup, err := c.command(runCtx, args, cfg)
+	if err != nil {
+		endSpan(-1, err)
+		return err
+	}
+	defer cleanup()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		err = fmt.Errorf("authy: failed to run CLI: %w", err)
+		endSpan(-1, err)
+		return err
+	}
+
+	start := time.Now()
+	finish := func(exitCode int, err error) error {
+		endSpan(exitCode, err)
+		c.logEvent(ctx, args, start, exitCode, err)
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		exitCode, err := commandError(ctx, cmd, err, nil)
+		return finish(exitCode, c.withArgs(err, args))
+	}
+	fnErr, decodeErr := decodeListStream(stdout, cfg, fn)
+	if fnErr != nil || decodeErr != nil {
+		stop()
+	}
+	waitErr := cmd.Wait()
+	switch {
+	case fnErr == errStopIteration:
+		// The caller stopped early; the CLI itself did not fail.
+		finish(0, nil)
+		return fnErr
+	case fnErr != nil:
+		return finish(-1, fnErr)
+	case decodeErr != nil:
+		return finish(-1, decodeErr)
+	case waitErr != nil:
+		exitCode, err := commandError(ctx, cmd, waitErr, stderr.Bytes())
+		return finish(exitCode, c.withArgs(err, args))
+	}
+	return finish(0, nil)
+}
+
+// decodeListStream reads a list response from r token by token, calling fn
+// for each entry that passes the name filters in cfg. It returns fn's error
+// separately from a decoding error. Empty input is an empty list.
+func decodeListStream(r io.Reader, cfg *callConfig, fn func(ListResult) error) (fnErr, err error) {
+	dec := json.NewDecoder(r)
+	invalid := func(err error) (error, error) {
+		return nil, fmt.Errorf("authy: invalid JSON output: %w", err)
+	}
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return invalid(err)
+	}
+	if tok != json.Delim('{') {
+		return invalid(fmt.Errorf("unexpected token %v", tok))
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return invalid(err)
+		}
+		if key != "secrets" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return invalid(err)
+			}
 			continue
 		}
-		name, ok := m["name"].(string)
-		if !ok {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return invalid(fmt.Errorf("expected secrets array"))
+		}
+		for dec.More() {
+			var entry ListResult
+			if err := dec.Decode(&entry); err != nil {
+				return invalid(err)
+			}
+			entry.parseTimes()
+			if entry.Name == "" || !cfg.matches(&entry) {
+				continue
+			}
+			if err := fn(entry); err != nil {
+				return err, nil
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return invalid(err)
+		}
+	}
+	return nil, nil
+}
+
+// matches reports whether entry passes the name filters, WithTag, and
+// ModifiedSince.
+func (cfg *callConfig) matches(entry *ListResult) bool {
+	if !cfg.matchesName(entry.Name) {
+		return false
+	}
+	for k, v := range cfg.tagFilter {
+		if got, ok := entry.Tags[k]; !ok || got != v {
+			return false
+		}
+	}
+	if !cfg.modifiedSince.IsZero() {
+		modified := entry.ModifiedAt
+		if modified.IsZero() {
+			modified = entry.CreatedAt
+		}
+		if modified.Before(cfg.modifiedSince) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesName reports whether name passes the WithPrefix and WithGlob
+// filters. The glob is validated by the caller before listing.
+func (cfg *callConfig) matchesName(name string) bool {
+	if !strings.HasPrefix(name, cfg.namePrefix) {
+		return false
+	}
+	if cfg.nameGlob != "" {
+		ok, _ := path.Match(cfg.nameGlob, name)
+		return ok
+	}
+	return true
+}
+
+// ListStale returns secrets that have never been rotated (version 1) and
+// whose last modification (or creation, if never modified) is older than
+// olderThan.
+func (c *Client) ListStale(ctx context.Context, olderThan time.Duration, opts ...CallOption) ([]ListResult, error) {
+	entries, err := c.ListDetailed(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	stale := make([]ListResult, 0)
+	for _, entry := range entries {
+		if entry.Version != 1 {
 			continue
 		}
-		names = append(names, name)
+		stamp := entry.Modified
+		if stamp == "" {
+			stamp = entry.Created
+		}
+		changed, err := time.Parse(time.RFC3339, stamp)
+		if err != nil {
+			return nil, fmt.Errorf("authy: invalid timestamp for %q: %w", entry.Name, err)
+		}
+		if changed.Before(cutoff) {
+			stale = append(stale, entry)
+		}
 	}
-	return names, nil
+	return stale, nil
+}
+
+// VerifyReport summarizes the result of a vault integrity check.
+type VerifyReport struct {
+	// Checked is the number of secrets examined.
+	Checked int
+	// Corrupt lists the secrets that could not be read back.
+	Corrupt []string
+}
+
+// VerifyOption configures Verify.
+type VerifyOption func(*verifyConfig)
+
+type verifyConfig struct {
+	decryptAll bool
 }
 
-// RunResult holds the exit code from a subprocess run.
+// VerifyDecryptAll makes Verify read every secret individually instead of
+// only decrypting the vault index. This spawns one subprocess per secret.
+func VerifyDecryptAll() VerifyOption {
+	return func(c *verifyConfig) {
+		c.decryptAll = true
+	}
+}
+
+// Verify checks that the vault can be decrypted and reports any secrets
+// that cannot be read. The authy CLI has no dedicated verify command, so by
+// default this decrypts the vault once via list; a failure there is returned
+// as an error. With VerifyDecryptAll, each secret is also fetched and those
+// that fail are reported in VerifyReport.Corrupt.
+func (c *Client) Verify(ctx context.Context, opts ...VerifyOption) (VerifyReport, error) {
+	cfg := &verifyConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	names, err := c.List(ctx)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	report := VerifyReport{Checked: len(names), Corrupt: []string{}}
+	if !cfg.decryptAll {
+		return report, nil
+	}
+	callCfg := c.newCallConfig(nil)
+	for _, name := range names {
+		// Bypass the Get cache: a cached value proves nothing about the
+		// vault's current contents.
+		var resp getResponse
+		err := c.runCmd(ctx, getArgs(name, callCfg), nil, callCfg, &resp)
+		if err == nil && resp.Value == nil {
+			err = resp.valueError()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report.Corrupt = append(report.Corrupt, name)
+		}
+	}
+	return report, nil
+}
+
+// RunResult holds the outcome of a subprocess run.
 type RunResult struct {
 	ExitCode int
+	// Stdout and Stderr hold the command's output. Each is nil if that
+	// stream was sent elsewhere with WithStdout or WithStderr, and both are
+	// nil with WithInteractive.
+	Stdout []byte
+	Stderr []byte
+	// Signaled reports whether the process was terminated by Signal. Under
+	// `authy run` this describes the authy process, since the CLI reports a
+	// signal-killed child as exit code 1; with WithEnvMapping the command is
+	// run directly and this describes it. Both are zero where the platform
+	// does not expose signal information.
+	Signaled bool
+	Signal   syscall.Signal
+}
+
+// setExitStatus records the exit code and any terminating signal from state.
+func (r *RunResult) setExitStatus(state *os.ProcessState) {
+	r.ExitCode = state.ExitCode()
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		r.Signaled = true
+		r.Signal = ws.Signal()
+	}
 }
 
 // Run executes a command with secrets injected as environment variables.
+// A non-zero exit from the command is reported in RunResult rather than as
+// an error; errors from authy itself (e.g. ErrAuthFailed) are returned.
 func (c *Client) Run(ctx context.Context, command []string, opts ...CallOption) (*RunResult, error) {
-	cfg := &callConfig{}
-	for _, opt := range opts {
-		opt(cfg)
+	cfg := c.newCallConfig(opts)
+	if err := cfg.checkInteractive(); err != nil {
+		return nil, err
+	}
+	if cfg.envMapping != nil {
+		return c.runMapped(ctx, command, cfg)
 	}
 	args := []string{"run"}
 	if cfg.scope != "" {
 		args = append(args, "--scope", cfg.scope)
 	}
+	args = append(args, namingArgs(cfg)...)
 	args = append(args, "--")
 	args = append(args, command...)
-	_, err := c.runCmd(ctx, args, "")
+	ctx, cancel := c.withTimeout(ctx, cfg)
+	defer cancel()
+	ctx, endSpan := c.startSpan(ctx, args, cfg)
+	cmd, cleanup, err := c.command(ctx, args, cfg)
 	if err != nil {
-		// For run, a non-zero exit from the child process is also an error.
-		if ae, ok := err.(*AuthyError); ok {
-			return &RunResult{ExitCode: ae.ExitCode}, nil
+		endSpan(-1, err)
+		return nil, err
+	}
+	defer cleanup()
+	cmd.Env = mergeEnv(cmd.Env, cfg.childEnv)
+	start := time.Now()
+	result, err := runChild(ctx, cmd, cfg, true)
+	err = c.withArgs(err, args)
+	exitCode := -1
+	if result != nil {
+		exitCode = result.ExitCode
+	} else if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	endSpan(exitCode, err)
+	c.logEvent(ctx, args, start, exitCode, err)
+	return result, err
+}
+
+// checkInteractive rejects stream options that conflict with
+// WithInteractive.
+func (cfg *callConfig) checkInteractive() error {
+	if cfg.interactive && (cfg.stdout != nil || cfg.stderr != nil || cfg.stdin != nil) {
+		return fmt.Errorf("authy: WithInteractive cannot be combined with WithStdout, WithStderr, or WithStdin")
+	}
+	return nil
+}
+
+// runMapped resolves the scoped secrets with `authy env` and runs command
+// directly, naming each env var with cfg.envMapping.
+func (c *Client) runMapped(ctx context.Context, command []string, cfg *callConfig) (*RunResult, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("authy: no command specified")
+	}
+	ctx, cancel := c.withTimeout(ctx, cfg)
+	defer cancel()
+	vars, err := c.envVars(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mirror the CLI: credentials are never passed on to the child.
+	env := make([]string, 0, len(os.Environ())+len(cfg.childEnv)+len(vars))
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "AUTHY_PASSPHRASE=") || strings.HasPrefix(kv, "AUTHY_TOKEN=") {
+			continue
 		}
+		env = append(env, kv)
+	}
+	env = append(env, cfg.childEnv...)
+	for name, value := range vars {
+		env = append(env, name+"="+value)
+	}
+	env = mergeEnv(env, nil)
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = env
+	c.setCancel(cmd)
+	return runChild(ctx, cmd, cfg, false)
+}
+
+// EnvMap returns the secrets readable under scope keyed by environment
+// variable name, as `authy run` would inject them, without starting a
+// process. An empty scope returns every secret, read with `authy export`,
+// which needs master credentials rather than a token. The naming options
+// WithUppercase, WithReplaceDash, WithEnvPrefix, and WithEnvMapping apply.
+func (c *Client) EnvMap(ctx context.Context, scope string, opts ...CallOption) (map[string]string, error) {
+	cfg := c.newCallConfig(opts)
+	cfg.scope = scope
+	ctx, cancel := c.withTimeout(ctx, cfg)
+	defer cancel()
+	return c.envVars(ctx, cfg)
+}
+
+// InjectEnv sets the variables from EnvMap in this process's environment
+// with os.Setenv, for hydrating configuration at startup instead of
+// wrapping the process with Run. Existing variables are overwritten.
+func (c *Client) InjectEnv(ctx context.Context, scope string, opts ...CallOption) error {
+	vars, err := c.EnvMap(ctx, scope, opts...)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for name, value := range vars {
+		if err := os.Setenv(name, value); err != nil {
+			errs = append(errs, fmt.Errorf("authy: setting %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// envVars resolves the secrets for cfg's scope, keyed by env var name. A
+// scoped call uses `authy env`; the CLI's env requires a scope (or a
+// .authy.toml), so an unscoped one reads every secret with
+// `authy export --format json`, which takes the same naming flags.
+func (c *Client) envVars(ctx context.Context, cfg *callConfig) (map[string]string, error) {
+	if cfg.scope == "" {
+		return c.exportVars(ctx, cfg)
+	}
+	var vars map[string]string
+	args := append([]string{"env", "--format", "json", "--scope", cfg.scope}, namingArgs(cfg)...)
+	if err := c.runCmd(ctx, args, nil, cfg, &vars); err != nil {
 		return nil, err
 	}
-	return &RunResult{ExitCode: 0}, nil
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	return applyEnvMapping(vars, cfg), nil
+}
+
+// exportVars is like envVars but always reads with `authy export --format
+// json`, where the scope is optional.
+func (c *Client) exportVars(ctx context.Context, cfg *callConfig) (map[string]string, error) {
+	entries, err := c.exportEntries(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(entries))
+	for _, e := range entries {
+		vars[e.Name] = e.Value
+	}
+	return applyEnvMapping(vars, cfg), nil
+}
+
+// applyEnvMapping renames vars with cfg's WithEnvMapping function, if any.
+func applyEnvMapping(vars map[string]string, cfg *callConfig) map[string]string {
+	if cfg.envMapping == nil {
+		return vars
+	}
+	mapped := make(map[string]string, len(vars))
+	for name, value := range vars {
+		mapped[cfg.envMapping(name)] = value
+	}
+	return mapped
+}
+
+// maxErrorCapture bounds how much streamed stderr is retained for detecting
+// authy's own JSON errors.
+const maxErrorCapture = 64 << 10
+
+// runChild runs cmd, collecting or streaming its output per cfg. When
+// viaAuthy is set, cmd is `authy run` and a JSON error on stderr means authy
+// itself failed before starting the child; that is returned as an error. If
+// ctx ends while the child is running, its error is returned.
+func runChild(ctx context.Context, cmd *exec.Cmd, cfg *callConfig, viaAuthy bool) (*RunResult, error) {
+	if cfg.interactive {
+		return runInteractive(ctx, cmd)
+	}
+	var stdout, stderr bytes.Buffer
+	errCapture := &limitedBuffer{limit: maxErrorCapture}
+	cmd.Stdin = cfg.stdin
+	if cfg.stdout != nil {
+		cmd.Stdout = cfg.stdout
+	} else {
+		cmd.Stdout = &stdout
+	}
+	if cfg.stderr != nil {
+		cmd.Stderr = io.MultiWriter(cfg.stderr, errCapture)
+	} else {
+		cmd.Stderr = io.MultiWriter(&stderr, errCapture)
+	}
+
+	err := cmd.Run()
+	result := &RunResult{}
+	if cfg.stdout == nil {
+		result.Stdout = stdout.Bytes()
+	}
+	if cfg.stderr == nil {
+		result.Stderr = stderr.Bytes()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctxError(ctx)
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		if viaAuthy && isJSONError(errCapture.Bytes()) {
+			ae := parseError(errCapture.Bytes(), exitErr.ExitCode())
+			ae.Err = exitErr
+			return nil, ae
+		}
+		result.setExitStatus(exitErr.ProcessState)
+	}
+	return result, nil
 }
 
-// ImportDotenv imports secrets from a .env file.
-func (c *Client) ImportDotenv(ctx context.Context, path string) error {
-	_, err := c.runCmd(ctx, []string{"import", path}, "")
+// runInteractive runs cmd attached to this process's terminal. Output is
+// neither captured nor inspected, so errors from authy itself surface only
+// as a non-zero exit code.
+func runInteractive(ctx context.Context, cmd *exec.Cmd) (*RunResult, error) {
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctxError(ctx)
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		result := &RunResult{}
+		result.setExitStatus(exitErr.ProcessState)
+		return result, nil
+	}
+	return &RunResult{}, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest, while reporting every write as successful. It is safe to read while
+// exec's copying goroutine is still writing to it.
+type limitedBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Bytes returns a copy of the bytes kept so far.
+func (b *limitedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// namingArgs builds the env var naming flags shared by run and env.
+func namingArgs(cfg *callConfig) []string {
+	var args []string
+	if cfg.uppercase {
+		args = append(args, "--uppercase")
+	}
+	if cfg.replaceDash != 0 {
+		args = append(args, "--replace-dash", string(cfg.replaceDash))
+	}
+	if cfg.envPrefix != "" {
+		args = append(args, "--prefix", cfg.envPrefix)
+	}
+	return args
+}
+
+// ExportDotenv writes secrets to w as KEY=value lines in dotenv format,
+// optionally filtered by WithScope and renamed with the env var naming
+// options. Values are quoted and escaped by `authy export` as needed; with
+// WithQuoting(QuoteAlways) the values are fetched with `authy export
+// --format json` and every one is quoted here, in sorted key order.
+//
+// The output contains plaintext secrets: protect w accordingly. The
+// contents are never logged, and the internal buffer is zeroed after
+// writing.
+func (c *Client) ExportDotenv(ctx context.Context, w io.Writer, opts ...CallOption) error {
+	cfg := c.newCallConfig(opts)
+	if cfg.quoting != QuoteAsNeeded {
+		ctx, cancel := c.withTimeout(ctx, cfg)
+		defer cancel()
+		vars, err := c.exportVars(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		out := formatDotenv(vars, cfg.quoting)
+		defer wipe(out)
+		_, err = w.Write(out)
+		return err
+	}
+	args := []string{"export", "--format", "env"}
+	if cfg.scope != "" {
+		args = append(args, "--scope", cfg.scope)
+	}
+	args = append(args, namingArgs(cfg)...)
+	out, err := c.runRaw(ctx, args, nil, cfg)
+	if err != nil {
+		return err
+	}
+	defer wipe(out)
+	_, err = w.Write(out)
 	return err
 }
 
+// ImportDotenv imports secrets from a .env file. By default secrets that
+// already exist are skipped; see OnConflict, ImportPrefix, and ImportScope.
+func (c *Client) ImportDotenv(ctx context.Context, path string, opts ...ImportOption) error {
+	cfg := &importConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	defer c.clearCache()
+	args := append([]string{"import", path}, cfg.flags()...)
+	if err := c.checkImport(ctx, args, nil, cfg); err != nil {
+		return err
+	}
+	return c.runCmd(ctx, args, nil, nil, nil)
+}
+
+// ImportResult reports what an import did, by vault secret name.
+type ImportResult struct {
+	// Imported holds the secrets that were created or overwritten.
+	Imported []string
+	// Skipped holds the secrets left untouched because they already existed.
+	Skipped []string
+}
+
+// ImportDotenvResult imports secrets from a .env file like ImportDotenv and
+// reports which names were imported and which were skipped. The CLI prints
+// no JSON for import, so skipped names are read from its stderr notices and
+// imported names are found by comparing the secret listing before and after;
+// this costs two extra list calls but never reads secret values.
+func (c *Client) ImportDotenvResult(ctx context.Context, path string, opts ...ImportOption) (ImportResult, error) {
+	cfg := &importConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	defer c.clearCache()
+	args := append([]string{"import", path}, cfg.flags()...)
+	if err := c.checkImport(ctx, args, nil, cfg); err != nil {
+		return ImportResult{}, err
+	}
+	before, err := c.ListDetailed(ctx)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var diag bytes.Buffer
+	if err := c.runCmd(ctx, args, nil, &callConfig{diagnostics: &diag}, nil); err != nil {
+		return ImportResult{}, err
+	}
+	after, err := c.ListDetailed(ctx)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	versions := make(map[string]int, len(before))
+	for _, e := range before {
+		versions[e.Name] = e.Version
+	}
+	result := ImportResult{Imported: []string{}, Skipped: parseSkipped(diag.String())}
+	for _, e := range after {
+		if v, ok := versions[e.Name]; !ok || e.Version > v {
+			result.Imported = append(result.Imported, e.Name)
+		}
+	}
+	return result, nil
+}
+
+// parseSkipped extracts the names from the CLI's
+// "Skipping 'name' (already exists, ...)" import notices.
+func parseSkipped(stderr string) []string {
+	skipped := []string{}
+	for _, line := range strings.Split(stderr, "\n") {
+		rest, ok := strings.CutPrefix(line, "Skipping '")
+		if !ok {
+			continue
+		}
+		if end := strings.Index(rest, "' (already exists"); end >= 0 {
+			skipped = append(skipped, rest[:end])
+		}
+	}
+	return skipped
+}
+
 // ImportOption configures import operations.
 type ImportOption func(*importConfig)
 
 type importConfig struct {
-	vault string
+	vault    string
+	prefix   string
+	scope    string
+	conflict ConflictPolicy
+}
+
+// ConflictPolicy selects what an import does with secrets that already
+// exist.
+type ConflictPolicy int
+
+const (
+	// ConflictSkip leaves existing secrets untouched, as the CLI does by
+	// default.
+	ConflictSkip ConflictPolicy = iota
+	// ConflictOverwrite replaces existing secrets, bumping their versions.
+	ConflictOverwrite
+	// ConflictFail aborts the import before anything is written if any
+	// secret already exists, returning ErrSecretAlreadyExists.
+	ConflictFail
+)
+
+// OnConflict sets how an import treats secrets that already exist. The
+// default is ConflictSkip.
+func OnConflict(p ConflictPolicy) ImportOption {
+	return func(c *importConfig) {
+		c.conflict = p
+	}
+}
+
+// ImportPrefix prepends prefix to every imported name, after the CLI has
+// converted it to lower-kebab-case.
+func ImportPrefix(prefix string) ImportOption {
+	return func(c *importConfig) {
+		c.prefix = prefix
+	}
+}
+
+// ImportScope restricts an import to the names readable under the scope's
+// policy. The CLI's import takes no scope, so the names are first listed
+// with a dry run and checked with `authy policy test`; if any is outside
+// the scope, ErrPolicyDenied is returned before anything is written.
+func ImportScope(scope string) ImportOption {
+	return func(c *importConfig) {
+		c.scope = scope
+	}
+}
+
+// flags returns the import flags for the prefix and conflict policy.
+func (cfg *importConfig) flags() []string {
+	var args []string
+	if cfg.prefix != "" {
+		args = append(args, "--prefix", cfg.prefix)
+	}
+	if cfg.conflict == ConflictOverwrite {
+		args = append(args, "--force")
+	}
+	return args
+}
+
+// checkImport enforces ConflictFail and ImportScope by running the import
+// with --dry-run first. The dry run's output holds value prefixes, so it is
+// zeroed once parsed.
+func (c *Client) checkImport(ctx context.Context, args []string, stdin []byte, cfg *importConfig) error {
+	if cfg.conflict != ConflictFail && cfg.scope == "" {
+		return nil
+	}
+	var in io.Reader
+	if stdin != nil {
+		in = bytes.NewReader(stdin)
+	}
+	var diag bytes.Buffer
+	dryRun := append(args[:len(args):len(args)], "--dry-run")
+	out, err := c.runRaw(ctx, dryRun, in, &callConfig{diagnostics: &diag})
+	if err != nil {
+		return err
+	}
+	defer wipe(out)
+
+	if skipped := parseSkipped(diag.String()); cfg.conflict == ConflictFail && len(skipped) > 0 {
+		return &AuthyError{
+			ExitCode: 5,
+			Code:     "already_exists",
+			Message:  "Secrets already exist: " + strings.Join(skipped, ", ") + " (import aborted)",
+		}
+	}
+	if cfg.scope != "" {
+		scope := &callConfig{scope: cfg.scope}
+		for _, name := range parseDryRun(out) {
+			if err := c.checkScope(ctx, name, scope); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseDryRun extracts the names from the CLI's
+// "[dry-run] create name = value" import lines.
+func parseDryRun(out []byte) []string {
+	var names []string
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		rest, ok := bytes.CutPrefix(line, []byte("[dry-run] "))
+		if !ok {
+			continue
+		}
+		_, rest, _ = bytes.Cut(rest, []byte(" "))
+		if name, _, ok := bytes.Cut(rest, []byte(" = ")); ok {
+			names = append(names, string(name))
+		}
+	}
+	return names
 }
 
 // ImportVault sets the vault name for external import sources.
@@ -183,20 +1603,77 @@ func (c *Client) ImportFrom(ctx context.Context, source string, opts ...ImportOp
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	defer c.clearCache()
 	args := []string{"import", "--from", source}
 	if cfg.vault != "" {
 		args = append(args, "--vault", cfg.vault)
 	}
-	_, err := c.runCmd(ctx, args, "")
-	return err
+	args = append(args, cfg.flags()...)
+	if err := c.checkImport(ctx, args, nil, cfg); err != nil {
+		return err
+	}
+	return c.runCmd(ctx, args, nil, nil, nil)
+}
+
+// ImportReader imports dotenv-formatted secrets read from r. The stream is
+// piped to `authy import -`, so the data never needs to exist as a file.
+// ImportVault has no effect for dotenv input. With OnConflict(ConflictFail)
+// or ImportScope the input is buffered, and zeroed afterwards, so it can be
+// checked with a dry run first.
+func (c *Client) ImportReader(ctx context.Context, r io.Reader, opts ...ImportOption) error {
+	cfg := &importConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	defer c.clearCache()
+	args := append([]string{"import", "-"}, cfg.flags()...)
+	if cfg.conflict != ConflictFail && cfg.scope == "" {
+		return c.runCmd(ctx, args, r, nil, nil)
+	}
+	data, err := io.ReadAll(r)
+	defer wipe(data)
+	if err != nil {
+		return fmt.Errorf("authy: reading import input: %w", err)
+	}
+	if err := c.checkImport(ctx, args, data, cfg); err != nil {
+		return err
+	}
+	return c.runCmd(ctx, args, bytes.NewReader(data), nil, nil)
 }
 
 // Init initializes a new authy vault.
 func (c *Client) Init(ctx context.Context) error {
-	_, err := c.runCmd(ctx, []string{"init"}, "")
+	return c.runCmd(ctx, []string{"init"}, nil, nil, nil)
+}
+
+// Ping checks that the binary runs, the vault exists, and the configured
+// credentials unlock it, without reading any secret value. The CLI has no
+// status command, so this is a single `authy list`. It returns nil on
+// success, or an error such as ErrVaultNotFound or ErrAuthFailed.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.runRaw(ctx, []string{"list"}, nil, nil)
 	return err
 }
 
+// Exec runs an arbitrary authy subcommand, for CLI features this package
+// does not wrap yet. args exclude the binary and the global --json flag,
+// which is added like for every other call; stdin may be nil. The raw JSON
+// output is returned for the caller to decode, or nil if the command printed
+// nothing. Failures are mapped to *AuthyError as usual.
+func (c *Client) Exec(ctx context.Context, args []string, stdin io.Reader) (json.RawMessage, error) {
+	out, err := c.runRaw(ctx, args, stdin, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	if !json.Valid(out) {
+		return nil, invalidJSON(out, errors.New("malformed output"))
+	}
+	return json.RawMessage(out), nil
+}
+
 // isNotFound checks whether an error represents a secret-not-found condition.
 func isNotFound(err error) bool {
 	ae, ok := err.(*AuthyError)
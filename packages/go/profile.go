@@ -0,0 +1,197 @@
+package authy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrProfileNotFound is returned by LoadProfile and NewFromProfile when the
+// profiles file has no profile of the requested name.
+var ErrProfileNotFound = errors.New("authy: profile not found")
+
+// Profile is a named set of client settings shared through a profiles
+// file. Empty fields leave the client's default in place.
+type Profile struct {
+	Name    string
+	Binary  string
+	Vault   string
+	Keyfile string
+	Config  string
+	Scope   string
+}
+
+// DefaultProfilesPath returns ~/.authy/profiles.toml.
+func DefaultProfilesPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("authy: locating profiles: %w", err)
+	}
+	return filepath.Join(home, ".authy", "profiles.toml"), nil
+}
+
+// LoadProfile reads the named profile from the TOML file at path. Each
+// profile is a table whose keys are string paths and names:
+//
+//	[prod]
+//	binary = "/usr/local/bin/authy"
+//	vault = "prod"
+//	keyfile = "~/.authy/keys/prod.key"
+//	config = "~/.authy/prod.toml"
+//	scope = "deploy"
+//
+// A leading ~/ in binary, keyfile, and config is expanded to the home
+// directory. Only tables and string values are supported; unknown keys are
+// an error so that typos do not go unnoticed.
+func LoadProfile(path, name string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("authy: reading profiles: %w", err)
+	}
+	defer f.Close()
+
+	var p *Profile
+	var section string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("authy: %s:%d: invalid table header", path, line)
+			}
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			if s, err := strconv.Unquote(section); err == nil {
+				section = s
+			}
+			if section == name {
+				p = &Profile{Name: name}
+			}
+			continue
+		}
+		if section != name {
+			continue
+		}
+		key, raw, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("authy: %s:%d: expected key = value", path, line)
+		}
+		value, err := tomlString(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("authy: %s:%d: %w", path, line, err)
+		}
+		switch key = strings.TrimSpace(key); key {
+		case "binary":
+			p.Binary, err = expandHome(value)
+		case "vault":
+			p.Vault = value
+		case "keyfile":
+			p.Keyfile, err = expandHome(value)
+		case "config":
+			p.Config, err = expandHome(value)
+		case "scope":
+			p.Scope = value
+		default:
+			return nil, fmt.Errorf("authy: %s:%d: unknown profile key %q", path, line, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("authy: reading profiles: %w", err)
+	}
+	if p == nil {
+		return nil, fmt.Errorf("%w: %q in %s", ErrProfileNotFound, name, path)
+	}
+	return p, nil
+}
+
+// Options returns the client options the profile sets.
+func (p *Profile) Options() []Option {
+	var opts []Option
+	if p.Binary != "" {
+		opts = append(opts, WithBinary(p.Binary))
+	}
+	if p.Vault != "" {
+		opts = append(opts, WithVault(p.Vault))
+	}
+	if p.Keyfile != "" {
+		opts = append(opts, WithKeyfile(p.Keyfile))
+	}
+	if p.Config != "" {
+		opts = append(opts, WithConfigFile(p.Config))
+	}
+	if p.Scope != "" {
+		opts = append(opts, WithDefaultScope(p.Scope))
+	}
+	return opts
+}
+
+// NewFromProfile creates a Client from the named profile in
+// DefaultProfilesPath. The remaining options are applied after the
+// profile's, so they override it. Use LoadProfile and Profile.Options to
+// read profiles from another path.
+func NewFromProfile(name string, opts ...Option) (*Client, error) {
+	path, err := DefaultProfilesPath()
+	if err != nil {
+		return nil, err
+	}
+	p, err := LoadProfile(path, name)
+	if err != nil {
+		return nil, err
+	}
+	return New(append(p.Options(), opts...)...)
+}
+
+// tomlString decodes a TOML basic or literal string, ignoring a trailing
+// comment.
+func tomlString(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := 1
+		for end < len(raw) && raw[end] != '"' {
+			if raw[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(raw) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after string: %q", rest)
+		}
+		return strconv.Unquote(raw[:end+1])
+	case strings.HasPrefix(raw, "'"):
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if rest := strings.TrimSpace(raw[end+2:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after string: %q", rest)
+		}
+		return raw[1 : end+1], nil
+	default:
+		return "", fmt.Errorf("expected a quoted string, got %q", raw)
+	}
+}
+
+// expandHome replaces a leading ~/ in path with the home directory.
+func expandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("authy: expanding %q: %w", path, err)
+	}
+	return filepath.Join(home, rest), nil
+}
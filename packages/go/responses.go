@@ -0,0 +1,82 @@
+package authy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// getResponse is the output of `authy get`. Decoding into it rejects
+// fields whose type has drifted, such as a numeric value.
+type getResponse struct {
+	Name        string            `json:"name"`
+	Value       *string           `json:"value"`
+	Version     *int              `json:"version"`
+	Created     string            `json:"created"`
+	Modified    string            `json:"modified"`
+	ExpiresAt   string            `json:"expires_at"`
+	Tags        map[string]string `json:"tags"`
+	Description string            `json:"description"`
+	Error       *jsonErrorDetail  `json:"error"`
+
+	// keys lists the top-level fields present, for reporting unexpected
+	// shapes.
+	keys []string
+}
+
+func (r *getResponse) UnmarshalJSON(data []byte) error {
+	type plain getResponse
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	r.keys = make([]string, 0, len(fields))
+	for k, v := range fields {
+		r.keys = append(r.keys, k)
+		wipe(v)
+	}
+	sort.Strings(r.keys)
+	return nil
+}
+
+// has reports whether key was present in the response.
+func (r *getResponse) has(key string) bool {
+	i := sort.SearchStrings(r.keys, key)
+	return i < len(r.keys) && r.keys[i] == key
+}
+
+// valueError explains why a get response has no string value: an error
+// object printed to stdout is mapped like one on stderr, an explicit null
+// value is ErrSecretEmpty, and any other shape is reported with the
+// top-level keys that were present.
+func (r *getResponse) valueError() error {
+	if r.Error != nil {
+		raw, err := json.Marshal(jsonErrorResponse{Error: *r.Error})
+		if err != nil {
+			return fmt.Errorf("authy: unexpected response format: %w", err)
+		}
+		return parseError(raw, r.Error.ExitCode)
+	}
+	if r.has("value") {
+		return ErrSecretEmpty
+	}
+	if len(r.keys) == 0 {
+		return fmt.Errorf("authy: unexpected response format (empty response)")
+	}
+	return fmt.Errorf("authy: unexpected response format (top-level keys: %s)", strings.Join(r.keys, ", "))
+}
+
+// listResponse is the output of `authy list`.
+type listResponse struct {
+	Secrets []ListResult `json:"secrets"`
+}
+
+// rotateResponse is the output of `authy rotate`, for CLI releases that
+// print one.
+type rotateResponse struct {
+	Version *int `json:"version"`
+}
@@ -0,0 +1,111 @@
+package authy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// retryPolicy controls how runCmd retries transient CLI failures.
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+	codes    map[string]bool
+}
+
+// defaultRetryCodes are the error codes WithRetry retries unless replaced
+// with WithRetryCodes. The CLI writes the vault through a shared temporary
+// file, so concurrent writers can make each other fail with io_error;
+// internal_error covers exit code 1 without a JSON error.
+var defaultRetryCodes = map[string]bool{
+	"internal_error": true,
+	"io_error":       true,
+}
+
+// readOnlyCommands lists the subcommands that are safe to retry without an
+// explicit AllowRetry opt-in.
+var readOnlyCommands = map[string]bool{
+	"get":  true,
+	"list": true,
+}
+
+// WithRetry makes the client retry failed calls up to attempts times in
+// total, waiting backoff before the first retry and doubling it after each
+// subsequent one. Only errors whose code is in the retry set (by default
+// "internal_error" and "io_error", see WithRetryCodes) are retried, never
+// not_found or auth_failed unless listed explicitly, and only for read
+// operations unless AllowRetry is passed to the call. A cancelled context
+// stops retrying immediately; the last error is returned if all attempts
+// fail.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.retry.attempts = attempts
+		c.retry.backoff = backoff
+	}
+}
+
+// WithRetryCodes replaces the set of error codes that WithRetry retries.
+func WithRetryCodes(codes ...string) Option {
+	return func(c *config) {
+		c.retry.codes = make(map[string]bool, len(codes))
+		for _, code := range codes {
+			c.retry.codes[code] = true
+		}
+	}
+}
+
+// AllowRetry opts a mutating call (e.g. Store, Remove) into the client's
+// retry policy. Only use it when repeating the operation is harmless.
+func AllowRetry() CallOption {
+	return func(c *callConfig) {
+		c.allowRetry = true
+	}
+}
+
+// shouldRetry reports whether a failed call may be attempted again.
+func (p *retryPolicy) shouldRetry(args []string, stdin io.Reader, cfg *callConfig, err error) bool {
+	if p.attempts <= 1 {
+		return false
+	}
+	if len(args) == 0 || !readOnlyCommands[args[0]] {
+		if cfg == nil || !cfg.allowRetry {
+			return false
+		}
+	}
+	var ae *AuthyError
+	if !errors.As(err, &ae) {
+		return false
+	}
+	codes := p.codes
+	if codes == nil {
+		codes = defaultRetryCodes
+	}
+	if !codes[ae.Code] {
+		return false
+	}
+	// A consumed stdin can only be replayed if it can be rewound.
+	if stdin != nil {
+		seeker, ok := stdin.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// wait sleeps for the backoff before retry number attempt (starting at 1),
+// returning false if ctx is done first.
+func (p *retryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(p.backoff << (attempt - 1))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
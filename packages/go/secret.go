@@ -0,0 +1,189 @@
+package authy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Secret holds a secret value in a byte slice that can be scrubbed with
+// Destroy once the caller is done with it.
+//
+// Zeroing is best effort: the Go runtime may have copied the data while it
+// was being read from the CLI, and any string made from Bytes cannot be
+// scrubbed. It narrows the window in which the value lingers in memory but
+// is not a guarantee.
+type Secret struct {
+	value []byte
+}
+
+// Bytes returns the secret value. The slice is overwritten by Destroy, so
+// callers must copy it if they need it afterwards.
+func (s *Secret) Bytes() []byte {
+	return s.value
+}
+
+// Reveal returns the secret value as a string. Unlike the byte slice from
+// Bytes, the string cannot be scrubbed by Destroy, so prefer Bytes where the
+// value's lifetime matters.
+func (s *Secret) Reveal() string {
+	return string(s.value)
+}
+
+// String returns "[REDACTED]" so that printing a Secret, e.g. with %v or a
+// logger, never exposes its value. Use Reveal or Bytes to read it.
+func (s *Secret) String() string {
+	return redactedText
+}
+
+// GoString returns "[REDACTED]" for the %#v verb.
+func (s *Secret) GoString() string {
+	return redactedText
+}
+
+// MarshalJSON encodes the Secret as the string "[REDACTED]", so structs
+// holding one can be serialized without leaking the value.
+func (s *Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redactedText)
+}
+
+// LogValue redacts the Secret when it is logged with log/slog.
+func (s *Secret) LogValue() slog.Value {
+	return slog.StringValue(redactedText)
+}
+
+// Destroy overwrites the secret value with zeros and releases it.
+func (s *Secret) Destroy() {
+	wipe(s.value)
+	s.value = nil
+}
+
+// GetSecret retrieves a secret like Get, but returns it as a Secret and
+// zeroes the intermediate buffers used to read it from the CLI.
+// Returns ErrSecretNotFound if the secret does not exist.
+func (c *Client) GetSecret(ctx context.Context, name string, opts ...CallOption) (*Secret, error) {
+	cfg := c.newCallConfig(opts)
+	out, err := c.runRaw(ctx, getArgs(name, cfg), nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(out)
+
+	var resp struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, invalidJSON(out, err)
+	}
+	defer wipe(resp.Value)
+
+	value, err := decodeJSONString(resp.Value)
+	if err != nil {
+		var full getResponse
+		if err := json.Unmarshal(out, &full); err != nil {
+			return nil, invalidJSON(out, err)
+		}
+		return nil, full.valueError()
+	}
+	return &Secret{value: value}, nil
+}
+
+// wipe overwrites b with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// decodeJSONString decodes a quoted JSON string into a new byte slice,
+// without going through an immutable Go string.
+func decodeJSONString(raw []byte) ([]byte, error) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return nil, errors.New("not a JSON string")
+	}
+	raw = raw[1 : len(raw)-1]
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		if ch != '\\' {
+			out = append(out, ch)
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			wipe(out)
+			return nil, errors.New("truncated escape")
+		}
+		switch raw[i] {
+		case '"', '\\', '/':
+			out = append(out, raw[i])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, n, ok := decodeUnicodeEscape(raw[i+1:])
+			if !ok {
+				wipe(out)
+				return nil, errors.New("invalid unicode escape")
+			}
+			out = utf8.AppendRune(out, r)
+			i += n
+		default:
+			wipe(out)
+			return nil, errors.New("invalid escape")
+		}
+	}
+	return out, nil
+}
+
+// decodeUnicodeEscape decodes the hex digits following a \u escape,
+// including a trailing low surrogate if present. It returns the rune and the
+// number of bytes consumed.
+func decodeUnicodeEscape(b []byte) (rune, int, bool) {
+	r1, ok := parseHex4(b)
+	if !ok {
+		return 0, 0, false
+	}
+	if !utf16.IsSurrogate(r1) {
+		return r1, 4, true
+	}
+	if len(b) >= 10 && b[4] == '\\' && b[5] == 'u' {
+		if r2, ok := parseHex4(b[6:]); ok {
+			if r := utf16.DecodeRune(r1, r2); r != utf8.RuneError {
+				return r, 10, true
+			}
+		}
+	}
+	return utf8.RuneError, 4, true
+}
+
+func parseHex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		r <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			r |= rune(c - '0')
+		case c >= 'a' && c <= 'f':
+			r |= rune(c - 'a' + 10)
+		case c >= 'A' && c <= 'F':
+			r |= rune(c - 'A' + 10)
+		default:
+			return 0, false
+		}
+	}
+	return r, true
+}
@@ -0,0 +1,338 @@
+package authy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ErrSessionClosed is returned by Session methods once the session has been
+// closed or its authy process has exited.
+var ErrSessionClosed = errors.New("authy: session closed")
+
+// maxSessionLine bounds a single response line read from the session.
+const maxSessionLine = 16 << 20
+
+// Session is a long-lived authy process that serves many operations over a
+// pipe, avoiding a subprocess spawn per call. It is backed by the CLI's
+// `serve --mcp` mode (line-delimited JSON-RPC), so credentials are handed
+// to a single process once. The CLI still decrypts the vault for each
+// request. Store and Remove share the client's write lock, so they do not
+// race the client's own writes. A Session is safe for concurrent use; call
+// Close when done.
+type Session struct {
+	client  *Client
+	cmd     *exec.Cmd
+	cleanup func()
+	stdin   io.WriteCloser
+	stderr  *limitedBuffer
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan rpcResponse
+	closed  bool
+
+	done chan struct{}
+	// readErr is why readLoop stopped before the output ended, such as a
+	// line over maxSessionLine. It is set before done is closed.
+	readErr error
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	ID     *int64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type toolResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+// StartSession launches `authy serve --mcp` and completes its handshake.
+// ctx bounds only the startup; the session lives until Close.
+func (c *Client) StartSession(ctx context.Context) (*Session, error) {
+	cmd, cleanup, err := c.command(context.WithoutCancel(ctx), []string{"serve", "--mcp"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{
+		client:  c,
+		cmd:     cmd,
+		cleanup: cleanup,
+		stderr:  &limitedBuffer{limit: maxErrorCapture},
+		pending: make(map[int64]chan rpcResponse),
+		done:    make(chan struct{}),
+	}
+	cmd.Stderr = s.stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("authy: failed to start session: %w", err)
+	}
+	if s.stdin, err = cmd.StdinPipe(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("authy: failed to start session: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return nil, runFailure(ctx, err)
+	}
+	go s.readLoop(stdout)
+
+	params := map[string]any{
+		"protocolVersion": "2024-11-05",
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "authy-go"},
+	}
+	if _, err := s.call(ctx, "initialize", params); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if err := s.send(rpcRequest{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get retrieves a secret's value. Returns ErrSecretNotFound if the secret
+// does not exist.
+func (s *Session) Get(ctx context.Context, name string) (string, error) {
+	return s.tool(ctx, "get_secret", map[string]any{"name": name})
+}
+
+// List returns the names of all secrets, optionally filtered by WithScope.
+func (s *Session) List(ctx context.Context, opts ...CallOption) ([]string, error) {
+	cfg := s.client.newCallConfig(opts)
+	args := map[string]any{}
+	if cfg.scope != "" {
+		args["scope"] = cfg.scope
+	}
+	text, err := s.tool(ctx, "list_secrets", args)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(text), &names); err != nil {
+		return nil, fmt.Errorf("authy: invalid list output: %w", err)
+	}
+	return names, nil
+}
+
+// Store creates a secret, or replaces it if Force() is passed. Returns
+// ErrSecretAlreadyExists if it exists and Force() was not passed.
+func (s *Session) Store(ctx context.Context, name, value string, opts ...CallOption) error {
+	cfg := s.client.newCallConfig(opts)
+	unlock, err := s.client.lockWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer s.client.InvalidateCache(name)
+	_, err = s.tool(ctx, "store_secret", map[string]any{"name": name, "value": value, "force": cfg.force})
+	return redact(err, value)
+}
+
+// Remove deletes a secret, reporting whether it existed.
+func (s *Session) Remove(ctx context.Context, name string) (bool, error) {
+	unlock, err := s.client.lockWrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	defer s.client.InvalidateCache(name)
+	text, err := s.tool(ctx, "remove_secret", map[string]any{"name": name})
+	if err != nil {
+		return false, err
+	}
+	return !strings.HasSuffix(text, "not found"), nil
+}
+
+// Close ends the session by closing the process's input and waiting for it
+// to exit. If the session stopped reading the process's output, such as
+// after a response line over 16 MiB, the process is killed instead.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.stdin.Close()
+	<-s.done
+	if s.readErr != nil {
+		// Nothing reads the process's output any more, so it may be blocked
+		// writing and never exit on its own.
+		s.cmd.Process.Kill()
+	}
+	err := s.cmd.Wait()
+	s.cleanup()
+	if s.readErr != nil {
+		return fmt.Errorf("authy: reading session output: %w", s.readErr)
+	}
+	if err != nil {
+		return fmt.Errorf("authy: session exited: %w", err)
+	}
+	return nil
+}
+
+// tool invokes an MCP tool and returns its text output. Tool failures are
+// mapped to *AuthyError by their message.
+func (s *Session) tool(ctx context.Context, name string, args map[string]any) (string, error) {
+	raw, err := s.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args})
+	if err != nil {
+		return "", err
+	}
+	var result toolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("authy: invalid session response: %w", err)
+	}
+	var text strings.Builder
+	for _, c := range result.Content {
+		if c.Type == "text" {
+			text.WriteString(c.Text)
+		}
+	}
+	if result.IsError {
+		return "", sessionError(text.String())
+	}
+	return text.String(), nil
+}
+
+// sessionErrorPrefixes maps the CLI's error messages to error codes, since
+// MCP tool errors carry only text.
+var sessionErrorPrefixes = []struct {
+	prefix   string
+	code     string
+	exitCode int
+}{
+	{"Vault not initialized", "vault_not_initialized", 7},
+	{"Secret not found", "not_found", 3},
+	{"Secret already exists", "already_exists", 5},
+	{"Access denied", "access_denied", 4},
+	{"Authentication failed", "auth_failed", 2},
+	{"No credentials configured", "auth_failed", 2},
+	{"Policy not found", "not_found", 3},
+}
+
+// sessionError converts an MCP tool error message into an *AuthyError.
+func sessionError(msg string) error {
+	for _, p := range sessionErrorPrefixes {
+		if strings.HasPrefix(msg, p.prefix) {
+			return &AuthyError{ExitCode: p.exitCode, Code: p.code, Message: msg}
+		}
+	}
+	return &AuthyError{ExitCode: 1, Code: "error", Message: msg}
+}
+
+// call sends a JSON-RPC request and waits for its response.
+func (s *Session) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	s.nextID++
+	id := s.nextID
+	ch := make(chan rpcResponse, 1)
+	s.pending[id] = ch
+	s.mu.Unlock()
+
+	if err := s.send(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		s.forget(id)
+		return nil, err
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, fmt.Errorf("authy: session %s: %s", method, resp.Error.Message)
+		}
+		return resp.Result, nil
+	case <-s.done:
+		return nil, s.exitError()
+	case <-ctx.Done():
+		s.forget(id)
+		return nil, ctxError(ctx)
+	}
+}
+
+// send writes one request line to the session.
+func (s *Session) send(req rpcRequest) error {
+	line, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("authy: encoding session request: %w", err)
+	}
+	defer wipe(line)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.stdin.Write(append(line, '\n')); err != nil {
+		return s.exitError()
+	}
+	return nil
+}
+
+func (s *Session) forget(id int64) {
+	s.mu.Lock()
+	delete(s.pending, id)
+	s.mu.Unlock()
+}
+
+// exitError describes why the session can no longer serve requests.
+func (s *Session) exitError() error {
+	select {
+	case <-s.done:
+	default:
+		return ErrSessionClosed
+	}
+	if s.readErr != nil {
+		return fmt.Errorf("%w: reading output: %v", ErrSessionClosed, s.readErr)
+	}
+	if stderr := strings.TrimSpace(string(s.stderr.Bytes())); stderr != "" {
+		return fmt.Errorf("%w: %s", ErrSessionClosed, stderr)
+	}
+	return ErrSessionClosed
+}
+
+// readLoop delivers responses to waiting calls until the process's output
+// ends.
+func (s *Session) readLoop(r io.Reader) {
+	defer close(s.done)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSessionLine)
+	for scanner.Scan() {
+		var resp rpcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil || resp.ID == nil {
+			continue
+		}
+		s.mu.Lock()
+		ch, ok := s.pending[*resp.ID]
+		delete(s.pending, *resp.ID)
+		s.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+	s.readErr = scanner.Err()
+}
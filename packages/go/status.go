@@ -0,0 +1,57 @@
+package authy
+
+import (
+	"context"
+	"errors"
+)
+
+// Status describes the client's vault and CLI, as reported by Status.
+type Status struct {
+	// VaultPath is the default vault location (see DefaultVaultPath). It
+	// does not reflect WithVault.
+	VaultPath string
+	// Initialized reports whether the CLI found a vault.
+	Initialized bool
+	// Unlocked reports whether the client's credentials decrypt the vault.
+	Unlocked bool
+	// SecretCount is the number of secrets visible to the credentials; it
+	// is 0 unless Unlocked.
+	SecretCount int
+	// CLIVersion is the version reported by `authy --version`, or "" if it
+	// could not be determined.
+	CLIVersion string
+}
+
+// Ready reports whether the vault can serve requests: it exists and the
+// client's credentials unlock it.
+func (s *Status) Ready() bool {
+	return s.Initialized && s.Unlocked
+}
+
+// Status checks the vault and CLI, for readiness probes. The CLI has no
+// status subcommand, so it runs `authy --version` and `authy list`: a
+// missing vault or rejected credentials are reported in the Status rather
+// than as an error. Other failures, such as ErrBinaryNotFound or a timeout,
+// are returned as errors.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	st := &Status{}
+	st.CLIVersion, _ = c.probeVersion(ctx)
+	st.VaultPath, _ = DefaultVaultPath()
+
+	var resp listResponse
+	err := c.runCmd(ctx, []string{"list"}, nil, nil, &resp)
+	switch {
+	case errors.Is(err, ErrVaultNotFound):
+		return st, nil
+	case errors.Is(err, ErrAuthFailed), errors.Is(err, ErrInvalidToken),
+		CodeOf(err) == "token_expired", CodeOf(err) == "token_revoked":
+		st.Initialized = true
+		return st, nil
+	case err != nil:
+		return nil, err
+	}
+	st.Initialized = true
+	st.Unlocked = true
+	st.SecretCount = len(resp.Secrets)
+	return st, nil
+}
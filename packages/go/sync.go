@@ -0,0 +1,226 @@
+package authy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SyncOption configures SyncTo.
+type SyncOption func(*syncConfig)
+
+type syncConfig struct {
+	scope       string
+	targetScope string
+	include     []string
+	exclude     []string
+	conflict    ConflictPolicy
+	dryRun      bool
+}
+
+// SyncScope limits the source secrets to those readable under scope.
+func SyncScope(scope string) SyncOption {
+	return func(c *syncConfig) {
+		c.scope = scope
+	}
+}
+
+// SyncTargetScope checks each write against the target's scope policy, as
+// WithScope does for Store, returning ErrPolicyDenied for names outside it.
+func SyncTargetScope(scope string) SyncOption {
+	return func(c *syncConfig) {
+		c.targetScope = scope
+	}
+}
+
+// SyncInclude limits the sync to names matching any of the path.Match
+// patterns. It may be passed more than once.
+func SyncInclude(patterns ...string) SyncOption {
+	return func(c *syncConfig) {
+		c.include = append(c.include, patterns...)
+	}
+}
+
+// SyncExclude leaves out names matching any of the path.Match patterns,
+// even if they match SyncInclude. It may be passed more than once.
+func SyncExclude(patterns ...string) SyncOption {
+	return func(c *syncConfig) {
+		c.exclude = append(c.exclude, patterns...)
+	}
+}
+
+// SyncConflict sets how SyncTo treats secrets that already exist in the
+// target. The default is ConflictSkip. ConflictOverwrite rotates secrets
+// whose value differs, so the target keeps their history, and
+// ConflictFail aborts before anything is written.
+func SyncConflict(p ConflictPolicy) SyncOption {
+	return func(c *syncConfig) {
+		c.conflict = p
+	}
+}
+
+// SyncDryRun makes SyncTo report what it would do without writing to the
+// target.
+func SyncDryRun() SyncOption {
+	return func(c *syncConfig) {
+		c.dryRun = true
+	}
+}
+
+// matches reports whether name passes the include and exclude filters.
+func (cfg *syncConfig) matches(name string) bool {
+	included := len(cfg.include) == 0
+	for _, p := range cfg.include {
+		if ok, _ := path.Match(p, name); ok {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, p := range cfg.exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// scoped returns the options selecting scope, leaving the client's default
+// scope in effect if scope is empty.
+func scoped(scope string) []CallOption {
+	if scope == "" {
+		return nil
+	}
+	return []CallOption{WithScope(scope)}
+}
+
+// SyncReport lists what SyncTo did, by secret name. Each list is sorted.
+type SyncReport struct {
+	// Created holds secrets that were new to the target.
+	Created []string
+	// Updated holds existing secrets that were rotated to the source value.
+	Updated []string
+	// Unchanged holds existing secrets that already had the source value.
+	Unchanged []string
+	// Skipped holds existing secrets left alone under ConflictSkip.
+	Skipped []string
+	// Failed holds the error for each secret that could not be synced.
+	Failed map[string]error
+}
+
+// SyncTo mirrors secrets from c into target, which may be a client for
+// another vault or the same vault under another scope. Names are selected
+// by SyncScope, SyncInclude, and SyncExclude; existing secrets in the
+// target are handled per SyncConflict. With SyncDryRun the report shows
+// what would change and nothing is written.
+//
+// Each value is read from c and written to target via stdin, so it passes
+// through this process's memory. A secret that fails does not stop the
+// rest: the report is returned together with an error joining one error per
+// failed name, as with StoreAll.
+func (c *Client) SyncTo(ctx context.Context, target *Client, opts ...SyncOption) (*SyncReport, error) {
+	cfg := &syncConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	for _, p := range append(cfg.include[:len(cfg.include):len(cfg.include)], cfg.exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("authy: invalid sync pattern %q: %w", p, err)
+		}
+	}
+
+	source, err := c.List(ctx, scoped(cfg.scope)...)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := target.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inTarget := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		inTarget[name] = true
+	}
+
+	var names, conflicts []string
+	for _, name := range source {
+		if cfg.matches(name) {
+			names = append(names, name)
+			if inTarget[name] {
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	if cfg.conflict == ConflictFail && len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, &AuthyError{
+			ExitCode: 5,
+			Code:     "already_exists",
+			Message:  "Secrets already exist: " + strings.Join(conflicts, ", ") + " (sync aborted)",
+		}
+	}
+
+	report := &SyncReport{
+		Created:   []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Skipped:   []string{},
+		Failed:    map[string]error{},
+	}
+	var errs []error
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if inTarget[name] && cfg.conflict == ConflictSkip {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+		if err := c.syncOne(ctx, target, name, inTarget[name], cfg, report); err != nil {
+			report.Failed[name] = err
+			errs = append(errs, fmt.Errorf("authy: sync %q: %w", name, err))
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// syncOne copies a single secret to target and records the outcome.
+func (c *Client) syncOne(ctx context.Context, target *Client, name string, exists bool, cfg *syncConfig, report *SyncReport) error {
+	value, err := c.Get(ctx, name, scoped(cfg.scope)...)
+	if err != nil {
+		return err
+	}
+	writeOpts := scoped(cfg.targetScope)
+	if !exists {
+		if !cfg.dryRun {
+			if err := target.Store(ctx, name, value, writeOpts...); err != nil {
+				return err
+			}
+		}
+		report.Created = append(report.Created, name)
+		return nil
+	}
+
+	current, err := target.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if current == value {
+		report.Unchanged = append(report.Unchanged, name)
+		return nil
+	}
+	if !cfg.dryRun {
+		if _, err := target.Rotate(ctx, name, value, writeOpts...); err != nil {
+			return err
+		}
+	}
+	report.Updated = append(report.Updated, name)
+	return nil
+}
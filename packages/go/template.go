@@ -0,0 +1,69 @@
+package authy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+// RenderTemplate executes tmpl as a Go text/template in which
+// {{ secret "name" }} expands to the named secret's value. Each distinct
+// secret is fetched once with Get, passing the options (such as WithScope);
+// a failed fetch aborts rendering with its error.
+//
+// The result contains plaintext secrets. Only the secret function is
+// provided, and the template is executed with no data.
+func (c *Client) RenderTemplate(ctx context.Context, tmpl string, opts ...CallOption) (string, error) {
+	out, err := c.renderTemplate(ctx, "template", tmpl, opts)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(out)
+	return string(out), nil
+}
+
+// RenderTemplateFile renders the template at inPath as RenderTemplate does
+// and writes the result to outPath. The output file is created with mode
+// 0600 and replaced atomically, so readers never see a partial file.
+func (c *Client) RenderTemplateFile(ctx context.Context, inPath, outPath string, opts ...CallOption) error {
+	tmpl, err := os.ReadFile(inPath)
+	if err != nil {
+		return fmt.Errorf("authy: reading template: %w", err)
+	}
+	out, err := c.renderTemplate(ctx, inPath, string(tmpl), opts)
+	if err != nil {
+		return err
+	}
+	defer wipe(out)
+	return writePrivateFile(outPath, out, "rendered template")
+}
+
+// renderTemplate executes tmpl and returns the output; the caller wipes it.
+func (c *Client) renderTemplate(ctx context.Context, name, tmpl string, opts []CallOption) ([]byte, error) {
+	values := make(map[string]string)
+	funcs := template.FuncMap{
+		"secret": func(name string) (string, error) {
+			if v, ok := values[name]; ok {
+				return v, nil
+			}
+			v, err := c.Get(ctx, name, opts...)
+			if err != nil {
+				return "", err
+			}
+			values[name] = v
+			return v, nil
+		},
+	}
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("authy: parsing template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nil); err != nil {
+		wipe(buf.Bytes())
+		return nil, fmt.Errorf("authy: rendering template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
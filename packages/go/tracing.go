@@ -0,0 +1,80 @@
+package authy
+
+import (
+	"context"
+	"errors"
+)
+
+// Tracer starts spans around CLI invocations. It is a small subset of the
+// OpenTelemetry tracing API, so that this package needs no dependency on
+// it; an adapter is a few lines:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string) (context.Context, authy.Span) {
+//		ctx, span := o.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ s trace.Span }
+//
+//	func (o otelSpan) SetAttribute(key string, value any) {
+//		o.s.SetAttributes(attribute.String(key, fmt.Sprint(value)))
+//	}
+//
+//	func (o otelSpan) RecordError(err error) {
+//		o.s.RecordError(err)
+//		o.s.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (o otelSpan) End() { o.s.End() }
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	// SetAttribute records a string or int attribute.
+	SetAttribute(key string, value any)
+	// RecordError marks the span as failed.
+	RecordError(err error)
+	End()
+}
+
+// WithTracer starts a span named "authy <subcommand>" for every CLI
+// invocation, as a child of the span in the call's context. Spans carry
+// the attributes authy.subcommand, authy.secret (omitted under
+// WithRedactNames), authy.scope, authy.exit_code, and authy.error_code;
+// never secret values. Retried attempts each get their own span.
+func WithTracer(t Tracer) Option {
+	return func(c *config) {
+		c.tracer = t
+	}
+}
+
+// startSpan starts a span for an invocation of args, returning the context
+// to run it under and a function that ends the span with its outcome.
+func (c *Client) startSpan(ctx context.Context, args []string, cfg *callConfig) (context.Context, func(exitCode int, err error)) {
+	if c.tracer == nil || len(args) == 0 {
+		return ctx, func(int, error) {}
+	}
+	ctx, span := c.tracer.Start(ctx, "authy "+args[0])
+	span.SetAttribute("authy.subcommand", args[0])
+	if name := c.secretName(args); name != "" {
+		span.SetAttribute("authy.secret", name)
+	}
+	if cfg != nil && cfg.scope != "" {
+		span.SetAttribute("authy.scope", cfg.scope)
+	}
+	return ctx, func(exitCode int, err error) {
+		span.SetAttribute("authy.exit_code", exitCode)
+		if err != nil {
+			var ae *AuthyError
+			if errors.As(err, &ae) {
+				span.SetAttribute("authy.error_code", ae.Code)
+			}
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
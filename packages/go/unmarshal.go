@@ -0,0 +1,120 @@
+package authy
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// secretField is a struct field tagged for Unmarshal.
+type secretField struct {
+	index    int
+	secret   string
+	optional bool
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Unmarshal fills the fields of the struct pointed to by v from the vault.
+// Each field tagged `authy:"secret-name"` is set to that secret's value;
+// fields may be string, []byte, or implement encoding.TextUnmarshaler.
+// Adding ",optional" to the tag leaves the field untouched if the secret
+// does not exist. Secrets are fetched concurrently as with BatchGet, and the
+// options are passed to each Get. All field errors are returned joined.
+func (c *Client) Unmarshal(ctx context.Context, v any, opts ...CallOption) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("authy: Unmarshal needs a non-nil pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+
+	fields, err := secretFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if !seen[f.secret] {
+			seen[f.secret] = true
+			names = append(names, f.secret)
+		}
+	}
+
+	values, failed := c.batchGet(ctx, names, opts)
+	var errs []error
+	for _, f := range fields {
+		field := rv.Type().Field(f.index)
+		if err, ok := failed[f.secret]; ok {
+			if !(f.optional && isNotFound(err)) {
+				errs = append(errs, fmt.Errorf("authy: field %s: get %q: %w", field.Name, f.secret, err))
+			}
+			continue
+		}
+		if err := setField(rv.Field(f.index), values[f.secret]); err != nil {
+			errs = append(errs, fmt.Errorf("authy: field %s: %w", field.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// secretFields returns the fields of t tagged with authy, checking that
+// each can be assigned.
+func secretFields(t reflect.Type) ([]secretField, error) {
+	var fields []secretField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("authy")
+		if !ok || tag == "-" {
+			continue
+		}
+		if !field.IsExported() {
+			return nil, fmt.Errorf("authy: field %s is tagged but unexported", field.Name)
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			return nil, fmt.Errorf("authy: field %s has an empty secret name", field.Name)
+		}
+		f := secretField{index: i, secret: name}
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "":
+			case "optional":
+				f.optional = true
+			default:
+				return nil, fmt.Errorf("authy: field %s has unknown tag option %q", field.Name, option)
+			}
+		}
+		if !assignable(field.Type) {
+			return nil, fmt.Errorf("authy: field %s has unsupported type %s", field.Name, field.Type)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// assignable reports whether setField can store a secret in a field of t.
+func assignable(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	return t.Kind() == reflect.String ||
+		(t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+}
+
+// setField stores value in field, preferring encoding.TextUnmarshaler.
+func setField(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	default:
+		field.SetBytes([]byte(value))
+	}
+	return nil
+}
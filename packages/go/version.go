@@ -0,0 +1,129 @@
+package authy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionTimeout bounds the `authy --version` probe run by New.
+const versionTimeout = 10 * time.Second
+
+// WithMinVersion makes New run `authy --version` and fail with
+// ErrIncompatibleCLI if the CLI is older than v (e.g. "0.7.0"). If the
+// binary does not report a recognizable version, the check is skipped and a
+// warning is sent to the WithLogger callback, if any.
+func WithMinVersion(v string) Option {
+	return func(c *config) {
+		c.minVersion = v
+	}
+}
+
+// Version returns the authy CLI version detected by New, or "" if it was
+// not checked (see WithMinVersion) or could not be determined.
+func (c *Client) Version() string {
+	return c.version
+}
+
+// CLIVersion runs `authy --version` and returns the version the CLI
+// reports, such as "0.7.1", without a leading "v". Unlike Version, it
+// always asks the binary, and it returns an error if the output holds no
+// recognizable version.
+func (c *Client) CLIVersion(ctx context.Context) (string, error) {
+	return c.probeVersion(ctx)
+}
+
+// checkVersion detects the CLI version and enforces the minimum.
+func (c *Client) checkVersion(minVersion string) error {
+	want, ok := parseVersion(minVersion)
+	if !ok {
+		return fmt.Errorf("authy: invalid minimum version %q", minVersion)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	version, err := c.probeVersion(ctx)
+	if err != nil {
+		if c.logger != nil {
+			c.logger(ctx, Event{
+				Subcommand: "--version",
+				ExitCode:   -1,
+				Warning:    "could not determine authy CLI version; skipping minimum version check",
+			})
+		}
+		return nil
+	}
+
+	c.version = version
+	if got, _ := parseVersion(version); compareVersions(got, want) < 0 {
+		return fmt.Errorf("%w: version %s is older than required %s", ErrIncompatibleCLI, c.version, minVersion)
+	}
+	return nil
+}
+
+// probeVersion runs `authy --version` and returns the version it reports,
+// without a leading "v".
+func (c *Client) probeVersion(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, c.binary, "--version")
+	cmd.Env = mergeEnv(os.Environ(), c.extraEnv)
+	out, err := cmd.Output()
+	if err != nil {
+		if runErr := runFailure(ctx, err); runErr != nil {
+			return "", runErr
+		}
+		return "", fmt.Errorf("authy: could not determine CLI version: %w", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("authy: could not determine CLI version: empty output")
+	}
+	version := fields[len(fields)-1]
+	if _, ok := parseVersion(version); !ok {
+		return "", fmt.Errorf("authy: could not determine CLI version from %q", strings.TrimSpace(string(out)))
+	}
+	return strings.TrimPrefix(version, "v"), nil
+}
+
+// parseVersion parses a semantic version such as "1.4.0" or "v1.4.0-rc.1"
+// into its numeric components. Pre-release and build suffixes are ignored.
+func parseVersion(s string) ([]int, bool) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	return nums, true
+}
+
+// compareVersions compares two parsed versions, treating missing trailing
+// components as zero.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,223 @@
+package authy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// WatchEvent reports a change to a watched secret.
+type WatchEvent struct {
+	Version  int
+	Modified time.Time
+	// Deleted is set on the final event sent when the secret disappears.
+	Deleted bool
+}
+
+// ChangeEvent reports a change to one of the secrets watched by WatchMany.
+type ChangeEvent struct {
+	Name     string
+	Version  int
+	Modified time.Time
+	// Deleted is set on the final event for a secret that disappears.
+	Deleted bool
+}
+
+// Watch polls GetMetadata every interval and sends an event whenever the
+// secret's version changes. If the secret is removed, a final event with
+// Deleted set is sent and the channel is closed. Other polling errors are
+// treated as transient and retried on the next tick. The channel is closed
+// when ctx is cancelled. The initial lookup happens before Watch returns, so
+// a missing secret is reported as ErrSecretNotFound.
+func (c *Client) Watch(ctx context.Context, name string, interval time.Duration) (<-chan WatchEvent, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("authy: watch interval must be positive, got %s", interval)
+	}
+	meta, err := c.GetMetadata(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan WatchEvent, 1)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		version := meta.Version
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			meta, err := c.GetMetadata(ctx, name)
+			var event WatchEvent
+			switch {
+			case errors.Is(err, ErrSecretNotFound):
+				event = WatchEvent{Version: version, Deleted: true}
+			case err != nil || meta.Version == version:
+				continue
+			default:
+				version = meta.Version
+				event = WatchEvent{Version: meta.Version, Modified: meta.Modified}
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+			if event.Deleted {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// WatchMany watches several secrets at once, as Watch does for one. Each
+// tick runs a single ListDetailed rather than one lookup per name, and an
+// event is sent for every secret whose version changed. A removed secret
+// gets a final event with Deleted set and is no longer watched; the channel
+// is closed once every secret is gone or ctx is cancelled. Polling errors
+// are retried on the next tick. The initial listing happens before WatchMany
+// returns, so a missing name is reported as ErrSecretNotFound.
+func (c *Client) WatchMany(ctx context.Context, names []string, interval time.Duration) (<-chan ChangeEvent, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("authy: watch interval must be positive, got %s", interval)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("authy: no secrets to watch")
+	}
+	current, err := c.watchVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]int, len(names))
+	for _, name := range names {
+		entry, ok := current[name]
+		if !ok {
+			return nil, fmt.Errorf("authy: watch %q: %w", name, ErrSecretNotFound)
+		}
+		versions[name] = entry.Version
+	}
+
+	events := make(chan ChangeEvent, len(versions))
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for len(versions) > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := c.watchVersions(ctx)
+			if err != nil {
+				continue
+			}
+			for _, name := range names {
+				version, watched := versions[name]
+				if !watched {
+					continue
+				}
+				var event ChangeEvent
+				entry, ok := current[name]
+				switch {
+				case !ok:
+					event = ChangeEvent{Name: name, Version: version, Deleted: true}
+					delete(versions, name)
+				case entry.Version == version:
+					continue
+				default:
+					versions[name] = entry.Version
+					event = ChangeEvent{Name: name, Version: entry.Version, Modified: entry.ModifiedAt}
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// watchVersions lists every secret, keyed by name.
+func (c *Client) watchVersions(ctx context.Context) (map[string]ListResult, error) {
+	entries, err := c.ListDetailed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]ListResult, len(entries))
+	for _, e := range entries {
+		byName[e.Name] = e
+	}
+	return byName, nil
+}
+
+// OnRotate registers fn to be called with the new value whenever the named
+// secret's version changes, for example to rebuild a database pool after a
+// credential rotation. Callbacks run only while RunRotateHooks is running,
+// one at a time, in registration order.
+func (c *Client) OnRotate(name string, fn func(newValue string)) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	if c.rotateHooks == nil {
+		c.rotateHooks = make(map[string][]func(string))
+	}
+	c.rotateHooks[name] = append(c.rotateHooks[name], fn)
+}
+
+// RunRotateHooks watches every secret registered with OnRotate, as
+// WatchMany does, and calls its callbacks with the new value after each
+// change. The new value is fetched with Get, bypassing the cache; a failed
+// fetch skips the callbacks for that change. Secrets registered after
+// RunRotateHooks starts are not watched until it is run again.
+//
+// It blocks until ctx is cancelled, returning ctx's error, or until every
+// watched secret has been removed, returning nil. With no callbacks
+// registered it returns nil at once. Errors from the initial lookup, such as
+// ErrSecretNotFound, are returned immediately.
+func (c *Client) RunRotateHooks(ctx context.Context, interval time.Duration) error {
+	c.hooksMu.Lock()
+	names := make([]string, 0, len(c.rotateHooks))
+	for name := range c.rotateHooks {
+		names = append(names, name)
+	}
+	c.hooksMu.Unlock()
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	events, err := c.WatchMany(ctx, names, interval)
+	if err != nil {
+		return err
+	}
+	for event := range events {
+		if event.Deleted {
+			continue
+		}
+		c.InvalidateCache(event.Name)
+		value, err := c.Get(ctx, event.Name)
+		if err != nil {
+			continue
+		}
+		c.hooksMu.Lock()
+		hooks := append([]func(string){}, c.rotateHooks[event.Name]...)
+		c.hooksMu.Unlock()
+		for _, fn := range hooks {
+			fn(value)
+		}
+	}
+	return ctx.Err()
+}